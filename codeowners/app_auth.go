@@ -0,0 +1,237 @@
+package codeowners
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v54/github"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/logging"
+	tpg "github.com/integrations/terraform-provider-github/v5/github"
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// appAuth holds the credentials of a GitHub App installation.
+type appAuth struct {
+	ID             string
+	InstallationID int64
+	PrivateKey     *rsa.PrivateKey
+}
+
+// expandAppAuth reads the 'app_auth' block of the provider configuration, returning nil if it has not been set.
+func expandAppAuth(in []interface{}) (*appAuth, error) {
+	if len(in) == 0 || in[0] == nil {
+		return nil, nil
+	}
+	attrs := in[0].(map[string]interface{})
+
+	id := attrs["id"].(string)
+	if id == "" {
+		return nil, errors.New("app_auth.id must be set and contain a non-empty value")
+	}
+
+	installationID, err := strconv.ParseInt(attrs["installation_id"].(string), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("app_auth.installation_id must be numeric: %v", err)
+	}
+
+	pemData := attrs["pem"].(string)
+	if pemFile := attrs["pem_file"].(string); pemFile != "" {
+		if pemData != "" {
+			return nil, errors.New("only one of app_auth.pem and app_auth.pem_file may be set")
+		}
+		b, err := os.ReadFile(pemFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read app_auth.pem_file: %v", err)
+		}
+		pemData = string(b)
+	}
+	if pemData == "" {
+		return nil, errors.New("one of app_auth.pem or app_auth.pem_file must be set")
+	}
+
+	// Some platforms (e.g. Terraform Cloud) do not support new lines in environment variables, so we accept escaped
+	// new lines as well.
+	key, err := parseAppPrivateKey([]byte(strings.ReplaceAll(pemData, `\n`, "\n")))
+	if err != nil {
+		return nil, err
+	}
+
+	return &appAuth{
+		ID:             id,
+		InstallationID: installationID,
+		PrivateKey:     key,
+	}, nil
+}
+
+func parseAppPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no decodeable PEM data found in GitHub App private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key must be an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// jwt returns a short-lived JSON Web Token authenticating as the GitHub App itself.
+func (a *appAuth) jwt(now time.Time) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: a.PrivateKey},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &jwt.Claims{
+		Issuer: a.ID,
+		// Backdate the token to accommodate any clock drift between us and GitHub.
+		IssuedAt: jwt.NewNumericDate(now.Add(-60 * time.Second)),
+		// The token is only used to mint installation tokens, so it can be short-lived.
+		Expiry: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	}
+
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+// appClient returns a client authenticated as the GitHub App itself.
+func (a *appAuth) appClient(ctx context.Context, c *clientFactory) (*github.Client, error) {
+	token, err := a.jwt(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate GitHub App JWT: %v", err)
+	}
+	return c.newClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+}
+
+// tokenSource returns a token source minting installation access tokens. Tokens are reused until they are about to
+// expire, at which point a new one is minted, so long-running applies are not interrupted.
+func (a *appAuth) tokenSource(ctx context.Context, c *clientFactory) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &installationTokenSource{
+		ctx:     ctx,
+		auth:    a,
+		factory: c,
+	})
+}
+
+type installationTokenSource struct {
+	ctx     context.Context
+	auth    *appAuth
+	factory *clientFactory
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	client, err := s.auth.appClient(s.ctx, s.factory)
+	if err != nil {
+		return nil, err
+	}
+
+	token, _, err := client.Apps.CreateInstallationToken(s.ctx, s.auth.InstallationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub App installation token: %v", err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		Expiry:      token.GetExpiresAt().Time,
+	}, nil
+}
+
+// botIdentity returns the username and email GitHub associates with commits made by the App's bot user.
+func (a *appAuth) botIdentity(ctx context.Context, c *clientFactory, client *github.Client) (string, string, error) {
+	ac, err := a.appClient(ctx, c)
+	if err != nil {
+		return "", "", err
+	}
+
+	app, _, err := ac.Apps.Get(ctx, "")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to retrieve GitHub App: %v", err)
+	}
+
+	login := fmt.Sprintf("%s[bot]", app.GetSlug())
+	user, _, err := client.Users.Get(ctx, login)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to retrieve GitHub App bot user %s: %v", login, err)
+	}
+
+	return login, fmt.Sprintf("%d+%s@users.noreply.github.com", user.GetID(), login), nil
+}
+
+// clientFactory creates GitHub clients pointing at the configured GitHub instance.
+type clientFactory struct {
+	baseURL   string
+	uploadURL string
+}
+
+// newClient creates a client using the given HTTP client, which makes one request at a time as GitHub recommends to
+// avoid its secondary rate limits.
+func (c *clientFactory) newClient(httpClient *http.Client) (*github.Client, error) {
+	config := tpg.Config{
+		BaseURL: c.baseURL,
+	}
+
+	return c.restClient(config, tpg.RateLimitedHTTPClient(httpClient, config.WriteDelay, config.ReadDelay, config.ParallelRequests))
+}
+
+// newParallelReadsClient creates a client making its read requests concurrently using the given HTTP client, while
+// its other requests are made by the serial client, one at a time alongside those of every other resource.
+func (c *clientFactory) newParallelReadsClient(httpClient *http.Client, serial *github.Client) (*github.Client, error) {
+	config := tpg.Config{
+		BaseURL: c.baseURL,
+	}
+
+	httpClient.Transport = &parallelReadsTransport{
+		reads:  logging.NewTransport("GitHub", httpClient.Transport),
+		writes: serial.Client().Transport,
+	}
+	return c.restClient(config, httpClient)
+}
+
+func (c *clientFactory) restClient(config tpg.Config, httpClient *http.Client) (*github.Client, error) {
+	client, err := config.NewRESTClient(httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := configureUploadURL(client, c.baseURL, c.uploadURL); err != nil {
+		return nil, fmt.Errorf("invalid upload_url: %v", err)
+	}
+
+	return client, nil
+}
+
+// parallelReadsTransport makes read requests concurrently, and hands the other requests to a transport which makes
+// them one at a time.
+type parallelReadsTransport struct {
+	reads  http.RoundTripper
+	writes http.RoundTripper
+}
+
+func (t *parallelReadsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.writes.RoundTrip(req)
+	}
+	// The rate limit transport keeps the delay before the next request unguarded when requests aren't serialised, so
+	// each read gets its own, which still waits out the rate limits.
+	return tpg.NewRateLimitTransport(t.reads, tpg.WithReadDelay(0), tpg.WithParallelRequests(true)).RoundTrip(req)
+}
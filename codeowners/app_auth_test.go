@@ -0,0 +1,187 @@
+package codeowners
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func generateTestAppKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return key, string(data)
+}
+
+func TestExpandAppAuth(t *testing.T) {
+	key, pemData := generateTestAppKey(t)
+
+	pemFile := filepath.Join(t.TempDir(), "app.pem")
+	require.NoError(t, os.WriteFile(pemFile, []byte(pemData), 0600))
+
+	t.Run("not set", func(t *testing.T) {
+		auth, err := expandAppAuth(nil)
+		require.NoError(t, err)
+		assert.Nil(t, auth)
+	})
+
+	t.Run("pem contents with escaped new lines", func(t *testing.T) {
+		auth, err := expandAppAuth([]interface{}{map[string]interface{}{
+			"id":              "123",
+			"installation_id": "456",
+			"pem":             strings.ReplaceAll(pemData, "\n", `\n`),
+			"pem_file":        "",
+		}})
+		require.NoError(t, err)
+		assert.Equal(t, "123", auth.ID)
+		assert.Equal(t, int64(456), auth.InstallationID)
+		assert.True(t, key.Equal(auth.PrivateKey))
+	})
+
+	t.Run("pem file", func(t *testing.T) {
+		auth, err := expandAppAuth([]interface{}{map[string]interface{}{
+			"id":              "123",
+			"installation_id": "456",
+			"pem":             "",
+			"pem_file":        pemFile,
+		}})
+		require.NoError(t, err)
+		assert.True(t, key.Equal(auth.PrivateKey))
+	})
+
+	t.Run("both pem and pem file", func(t *testing.T) {
+		_, err := expandAppAuth([]interface{}{map[string]interface{}{
+			"id":              "123",
+			"installation_id": "456",
+			"pem":             pemData,
+			"pem_file":        pemFile,
+		}})
+		assert.Error(t, err)
+	})
+
+	t.Run("non-numeric installation id", func(t *testing.T) {
+		_, err := expandAppAuth([]interface{}{map[string]interface{}{
+			"id":              "123",
+			"installation_id": "abc",
+			"pem":             pemData,
+			"pem_file":        "",
+		}})
+		assert.Error(t, err)
+	})
+}
+
+func TestAppAuthJWT(t *testing.T) {
+	key, _ := generateTestAppKey(t)
+	auth := &appAuth{ID: "123", InstallationID: 456, PrivateKey: key}
+
+	now := time.Now()
+	raw, err := auth.jwt(now)
+	require.NoError(t, err)
+
+	token, err := jwt.ParseSigned(raw)
+	require.NoError(t, err)
+
+	claims := jwt.Claims{}
+	require.NoError(t, token.Claims(&key.PublicKey, &claims))
+	assert.Equal(t, "123", claims.Issuer)
+	assert.NoError(t, claims.Validate(jwt.Expected{Issuer: "123", Time: now}))
+}
+
+func TestInstallationTokenSourceRefreshesExpiredTokens(t *testing.T) {
+	key, _ := generateTestAppKey(t)
+	auth := &appAuth{ID: "123", InstallationID: 456, PrivateKey: key}
+
+	var minted int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v3/app/installations/456/access_tokens", r.URL.Path)
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "))
+		n := atomic.AddInt32(&minted, 1)
+		// The first token is already expired, forcing the token source to mint another one.
+		expiry := time.Now().Add(-time.Minute)
+		if n > 1 {
+			expiry = time.Now().Add(time.Hour)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "token-%d", "expires_at": %q}`, n, expiry.UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	ts := auth.tokenSource(context.Background(), &clientFactory{baseURL: server.URL + "/"})
+
+	first, err := ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", first.AccessToken)
+
+	second, err := ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", second.AccessToken)
+
+	third, err := ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", third.AccessToken)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&minted))
+}
+
+func TestClientFactoryParallelReads(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		t.Run(method, func(t *testing.T) {
+			var inFlight, maxInFlight int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&inFlight, 1)
+				for {
+					m := atomic.LoadInt32(&maxInFlight)
+					if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+						break
+					}
+				}
+				time.Sleep(50 * time.Millisecond)
+				atomic.AddInt32(&inFlight, -1)
+				fmt.Fprint(w, `{}`)
+			}))
+			defer server.Close()
+
+			factory := &clientFactory{baseURL: server.URL + "/"}
+			serial, err := factory.newClient(&http.Client{Transport: http.DefaultTransport})
+			require.NoError(t, err)
+			client, err := factory.newParallelReadsClient(&http.Client{Transport: http.DefaultTransport}, serial)
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					req, err := client.NewRequest(method, "repos/o/r", nil)
+					if assert.NoError(t, err) {
+						_, err = client.Do(context.Background(), req, nil)
+						assert.NoError(t, err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if method == http.MethodGet {
+				assert.Greater(t, atomic.LoadInt32(&maxInFlight), int32(1))
+			} else {
+				// The writes are made one at a time by the serial client.
+				assert.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight))
+			}
+		})
+	}
+}
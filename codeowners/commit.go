@@ -0,0 +1,287 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/form3tech-oss/go-github-utils/pkg/branch"
+	"github.com/google/go-github/v54/github"
+)
+
+const (
+	// commitModePush commits straight to the target branch, failing unless the update is a fast-forward.
+	commitModePush = "push"
+	// commitModeMerge opens a pull request against the target branch and merges it straight away.
+	commitModeMerge = "merge"
+	// commitModeReview opens a pull request against the target branch and leaves it open for review.
+	commitModeReview = "review"
+
+	branchRefPrefix = "refs/heads/"
+
+	pullRequestStateOpen = "open"
+)
+
+var commitModes = []string{commitModePush, commitModeMerge, commitModeReview}
+
+// reviewModeUnsupportedError returns the error reported by the resources which cannot track pull requests left open
+// for review.
+func reviewModeUnsupportedError(resource string) error {
+	return fmt.Errorf("the %q commit mode is not supported by %s, as it cannot track pull requests left open for review - use %q or %q instead",
+		commitModeReview, resource, commitModePush, commitModeMerge)
+}
+
+type commitOptions struct {
+	RepoOwner     string
+	RepoName      string
+	Branch        string
+	CommitMessage string
+	Changes       []*github.TreeEntry
+	Mode          string
+	// PullRequestOptions configures the pull requests opened in merge and review modes.
+	PullRequestOptions *pullRequestOptions
+	PullRequestBody    string
+	// PullRequest is an open pull request previously created in review mode, which will be updated in place rather
+	// than opening a new one. Only used in review mode.
+	PullRequest *github.PullRequest
+}
+
+type commitResult struct {
+	CommitSHA   string
+	PullRequest *github.PullRequest
+}
+
+// deletionEntry returns the tree entry removing the file at the given path according to the delete behavior: an empty
+// file when emptying it, and otherwise an entry with neither content nor a SHA, which deletes the file from the base
+// tree.
+func deletionEntry(path, behavior string) *github.TreeEntry {
+	entry := &github.TreeEntry{
+		Path: github.String(path),
+		Type: github.String("blob"),
+		Mode: github.String("100644"),
+	}
+	if behavior == deleteEmptyFile {
+		entry.Content = github.String("")
+	}
+	return entry
+}
+
+// createCommit commits the requested changes to the target branch using the requested commit mode.
+func (c *providerConfiguration) createCommit(ctx context.Context, options *commitOptions) (*commitResult, error) {
+	// Use the default branch if none is specified.
+	b := options.Branch
+	if b == "" {
+		v, err := branch.GetDefaultBranch(ctx, c.client, options.RepoOwner, options.RepoName)
+		if err != nil {
+			return nil, err
+		}
+		b = v
+	}
+
+	// Get the SHA for the target branch.
+	s, err := branch.GetSHAForBranch(ctx, c.client, options.RepoOwner, options.RepoName, b)
+	if err != nil {
+		return nil, err
+	}
+
+	newCommit, err := c.createCommitObject(ctx, options, s)
+	if err != nil {
+		return nil, err
+	}
+	result := &commitResult{
+		CommitSHA: newCommit.GetSHA(),
+	}
+
+	if options.Mode == commitModePush {
+		if _, _, err := c.client.Git.UpdateRef(ctx, options.RepoOwner, options.RepoName, &github.Reference{
+			Ref:    github.String(branchRefPrefix + b),
+			Object: &github.GitObject{SHA: newCommit.SHA},
+		}, false); err != nil {
+			return nil, fmt.Errorf("failed to update branch %s: %v", b, err)
+		}
+		return result, nil
+	}
+
+	if options.PullRequest != nil {
+		// Point the existing pull request at the new commit. The source branch is ours, so it's safe to force the update.
+		if _, _, err := c.client.Git.UpdateRef(ctx, options.RepoOwner, options.RepoName, &github.Reference{
+			Ref:    github.String(branchRefPrefix + options.PullRequest.GetHead().GetRef()),
+			Object: &github.GitObject{SHA: newCommit.SHA},
+		}, true); err != nil {
+			return nil, fmt.Errorf("failed to update PR #%d: %v", options.PullRequest.GetNumber(), err)
+		}
+		pr, _, err := c.client.PullRequests.Edit(ctx, options.RepoOwner, options.RepoName, options.PullRequest.GetNumber(), &github.PullRequest{
+			Title: github.String(options.CommitMessage),
+			Body:  github.String(options.PullRequestBody),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update PR #%d: %v", options.PullRequest.GetNumber(), err)
+		}
+		result.PullRequest = pr
+		return result, nil
+	}
+
+	prRef, _, err := c.client.Git.CreateRef(ctx, options.RepoOwner, options.RepoName, &github.Reference{
+		Ref:    github.String(fmt.Sprintf("%sterraform-provider-codeowners-%d", branchRefPrefix, time.Now().UnixNano())),
+		Object: &github.GitObject{SHA: newCommit.SHA},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pr, _, err := c.client.PullRequests.Create(ctx, options.RepoOwner, options.RepoName, &github.NewPullRequest{
+		Title:               github.String(options.CommitMessage),
+		Head:                prRef.Ref,
+		Base:                github.String(b),
+		Body:                github.String(options.PullRequestBody),
+		MaintainerCanModify: github.Bool(false),
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.PullRequest = pr
+
+	if err := c.decoratePullRequest(ctx, options, pr); err != nil {
+		return nil, err
+	}
+
+	if options.Mode == commitModeReview {
+		return result, nil
+	}
+	return result, c.mergePullRequest(ctx, options, pr)
+}
+
+// createCommitObject creates a (possibly signed) commit containing the requested changes on top of the given parent.
+func (c *providerConfiguration) createCommitObject(ctx context.Context, options *commitOptions, parentSHA string) (*github.Commit, error) {
+	// create tree containing required changes
+	tree, _, err := c.client.Git.CreateTree(ctx, options.RepoOwner, options.RepoName, parentSHA, options.Changes)
+	if err != nil {
+		return nil, err
+	}
+
+	// get parent commit
+	parent, _, err := c.client.Repositories.GetCommit(ctx, options.RepoOwner, options.RepoName, parentSHA, &github.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// This is not always populated, but is needed.
+	parent.Commit.SHA = github.String(parent.GetSHA())
+
+	commit := &github.Commit{
+		Author: &github.CommitAuthor{
+			Date:  &github.Timestamp{Time: time.Now()},
+			Name:  github.String(c.ghUsername),
+			Email: github.String(c.ghEmail),
+		},
+		Message: github.String(options.CommitMessage),
+		Tree:    tree,
+		Parents: []*github.Commit{parent.Commit},
+	}
+
+	if c.gpgKey != "" {
+		k, err := readGPGPrivateKey(c.gpgKey, c.gpgPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		commit.SigningKey = k
+	}
+
+	newCommit, _, err := c.client.Git.CreateCommit(ctx, options.RepoOwner, options.RepoName, commit)
+	return newCommit, err
+}
+
+// mergePullRequest merges the pull request, retrying while GitHub works out whether it is mergeable. If the pull
+// request cannot be merged it is closed.
+func (c *providerConfiguration) mergePullRequest(ctx context.Context, options *commitOptions, pr *github.PullRequest) error {
+	var mergeOptions *github.PullRequestOptions
+	if options.PullRequestOptions != nil {
+		mergeOptions = &github.PullRequestOptions{
+			MergeMethod: options.PullRequestOptions.MergeMethod,
+		}
+	}
+	for retryCount := 1; retryCount <= c.maxRetries; retryCount++ {
+		_, res, err := c.client.PullRequests.Merge(ctx, options.RepoOwner, options.RepoName, pr.GetNumber(), options.CommitMessage, mergeOptions)
+		if err == nil {
+			// PR was merged, so we can attempt to remove our working branch.
+			// This isn't a critical operation, hence we do not error out if we fail to do so.
+			_, _ = c.client.Git.DeleteRef(ctx, options.RepoOwner, options.RepoName, branchRefPrefix+pr.GetHead().GetRef())
+			return nil
+		}
+		if retryCount < c.maxRetries {
+			// Give some additional time for GitHub to finish checking if the PR is mergeable and retry.
+			time.Sleep(c.retryBackoff)
+			continue
+		}
+		// The PR couldn't be merged after the specified number of retries.
+		// Therefore, we try close it and error out.
+		_, _, _ = c.client.PullRequests.Edit(ctx, options.RepoOwner, options.RepoName, pr.GetNumber(), &github.PullRequest{
+			State: github.String("closed"),
+		})
+		if res != nil {
+			return fmt.Errorf("failed to merge PR: HTTP %d: %v", res.StatusCode, err)
+		}
+		return fmt.Errorf("failed to merge PR: %v", err)
+	}
+	return nil
+}
+
+// decoratePullRequest adds the requested labels and reviewers to a newly opened pull request.
+func (c *providerConfiguration) decoratePullRequest(ctx context.Context, options *commitOptions, pr *github.PullRequest) error {
+	o := options.PullRequestOptions
+	if o == nil {
+		return nil
+	}
+	if len(o.Labels) > 0 {
+		if _, _, err := c.client.Issues.AddLabelsToIssue(ctx, options.RepoOwner, options.RepoName, pr.GetNumber(), o.Labels); err != nil {
+			return fmt.Errorf("failed to label PR #%d: %v", pr.GetNumber(), err)
+		}
+	}
+	if len(o.Reviewers) > 0 || len(o.TeamReviewers) > 0 {
+		if _, _, err := c.client.PullRequests.RequestReviewers(ctx, options.RepoOwner, options.RepoName, pr.GetNumber(), github.ReviewersRequest{
+			Reviewers:     o.Reviewers,
+			TeamReviewers: o.TeamReviewers,
+		}); err != nil {
+			return fmt.Errorf("failed to request reviewers for PR #%d: %v", pr.GetNumber(), err)
+		}
+	}
+	return nil
+}
+
+// closePullRequest closes a pull request previously opened in review mode, along with its source branch.
+func (c *providerConfiguration) closePullRequest(ctx context.Context, owner, name string, pr *github.PullRequest) error {
+	if _, _, err := c.client.PullRequests.Edit(ctx, owner, name, pr.GetNumber(), &github.PullRequest{
+		State: github.String("closed"),
+	}); err != nil {
+		return fmt.Errorf("failed to close PR #%d: %v", pr.GetNumber(), err)
+	}
+	_, _ = c.client.Git.DeleteRef(ctx, owner, name, branchRefPrefix+pr.GetHead().GetRef())
+	return nil
+}
+
+func readGPGPrivateKey(privateKey string, passphrase string) (*openpgp.Entity, error) {
+	entityList, err := openpgp.ReadArmoredKeyRing(strings.NewReader(privateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	pk := entityList[0]
+	ppb := []byte(passphrase)
+
+	if pk.PrivateKey != nil && pk.PrivateKey.Encrypted {
+		if err := pk.PrivateKey.Decrypt(ppb); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, subKey := range pk.Subkeys {
+		if subKey.PrivateKey != nil && subKey.PrivateKey.Encrypted {
+			if err := subKey.PrivateKey.Decrypt(ppb); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return pk, nil
+}
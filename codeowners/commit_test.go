@@ -0,0 +1,196 @@
+package codeowners
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v54/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHub is a minimal stand-in for the GitHub API, recording the requests made against it.
+type fakeGitHub struct {
+	*httptest.Server
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	f := &fakeGitHub{mux: http.NewServeMux()}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+		f.mu.Unlock()
+		f.mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// handle registers a handler replying with the given JSON body.
+func (f *fakeGitHub) handle(pattern string, status int, body string) {
+	f.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	})
+}
+
+// handleCommit registers the handlers needed to create a commit on top of the 'main' branch of 'o/r'.
+func (f *fakeGitHub) handleCommit() {
+	f.handle("/repos/o/r/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+	f.handle("/repos/o/r/git/trees", http.StatusCreated, `{"sha": "tree"}`)
+	f.handle("/repos/o/r/commits/head", http.StatusOK, `{"sha": "head", "commit": {}}`)
+	f.handle("/repos/o/r/git/commits", http.StatusCreated, `{"sha": "new-commit"}`)
+}
+
+func (f *fakeGitHub) config(t *testing.T) *providerConfiguration {
+	client := github.NewClient(nil)
+	u, err := url.Parse(f.URL + "/")
+	require.NoError(t, err)
+	client.BaseURL = u
+	return &providerConfiguration{
+		client:       client,
+		ghUsername:   "someone",
+		ghEmail:      "someone@example.com",
+		maxRetries:   1,
+		retryBackoff: 0,
+		ownerChecks:  newOwnerCheckCache(),
+	}
+}
+
+func (f *fakeGitHub) made(request string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.requests {
+		if r == request {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCreateCommitPush(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handleCommit()
+
+	var update map[string]interface{}
+	f.mux.HandleFunc("/repos/o/r/git/refs/heads/main", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+		fmt.Fprint(w, `{"ref": "refs/heads/main", "object": {"sha": "new-commit"}}`)
+	})
+
+	result, err := f.config(t).createCommit(context.Background(), &commitOptions{
+		RepoOwner: "o",
+		RepoName:  "r",
+		Branch:    "main",
+		Mode:      commitModePush,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "new-commit", result.CommitSHA)
+	assert.Nil(t, result.PullRequest)
+	assert.Equal(t, map[string]interface{}{"sha": "new-commit", "force": false}, update)
+	assert.False(t, f.made("POST /repos/o/r/pulls"))
+}
+
+func TestCreateCommitMerge(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handleCommit()
+	f.handle("/repos/o/r/git/refs", http.StatusCreated, `{"ref": "refs/heads/terraform-provider-codeowners-1", "object": {"sha": "new-commit"}}`)
+	f.handle("/repos/o/r/pulls", http.StatusCreated, `{"number": 1, "head": {"ref": "terraform-provider-codeowners-1"}}`)
+	f.handle("/repos/o/r/issues/1/labels", http.StatusOK, `[]`)
+	f.handle("/repos/o/r/pulls/1/requested_reviewers", http.StatusCreated, `{"number": 1}`)
+	f.handle("/repos/o/r/git/refs/heads/terraform-provider-codeowners-1", http.StatusNoContent, ``)
+
+	var merge map[string]interface{}
+	f.mux.HandleFunc("/repos/o/r/pulls/1/merge", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&merge))
+		fmt.Fprint(w, `{"merged": true}`)
+	})
+
+	result, err := f.config(t).createCommit(context.Background(), &commitOptions{
+		RepoOwner:     "o",
+		RepoName:      "r",
+		Branch:        "main",
+		CommitMessage: "Adding CODEOWNERS file",
+		Mode:          commitModeMerge,
+		PullRequestOptions: &pullRequestOptions{
+			MergeMethod:   "squash",
+			Labels:        []string{"codeowners"},
+			TeamReviewers: []string{"platform"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.PullRequest.GetNumber())
+	assert.Equal(t, "squash", merge["merge_method"])
+	assert.True(t, f.made("POST /repos/o/r/issues/1/labels"))
+	assert.True(t, f.made("POST /repos/o/r/pulls/1/requested_reviewers"))
+	assert.True(t, f.made("PUT /repos/o/r/pulls/1/merge"))
+	assert.True(t, f.made("DELETE /repos/o/r/git/refs/heads/terraform-provider-codeowners-1"))
+}
+
+func TestCreateCommitReview(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handleCommit()
+	f.handle("/repos/o/r/git/refs", http.StatusCreated, `{"ref": "refs/heads/terraform-provider-codeowners-1", "object": {"sha": "new-commit"}}`)
+	f.handle("/repos/o/r/pulls", http.StatusCreated, `{"number": 1, "html_url": "https://github.com/o/r/pull/1", "head": {"ref": "terraform-provider-codeowners-1"}}`)
+
+	result, err := f.config(t).createCommit(context.Background(), &commitOptions{
+		RepoOwner: "o",
+		RepoName:  "r",
+		Branch:    "main",
+		Mode:      commitModeReview,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://github.com/o/r/pull/1", result.PullRequest.GetHTMLURL())
+	assert.False(t, f.made("PUT /repos/o/r/pulls/1/merge"))
+}
+
+func TestCreateCommitReviewUpdatesPendingPullRequest(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handleCommit()
+
+	var update map[string]interface{}
+	f.mux.HandleFunc("/repos/o/r/git/refs/heads/terraform-provider-codeowners-1", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+		fmt.Fprint(w, `{"ref": "refs/heads/terraform-provider-codeowners-1", "object": {"sha": "new-commit"}}`)
+	})
+
+	var edit map[string]interface{}
+	f.mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&edit))
+		fmt.Fprint(w, `{"number": 1, "body": "new body", "head": {"ref": "terraform-provider-codeowners-1"}}`)
+	})
+
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Head:   &github.PullRequestBranch{Ref: github.String("terraform-provider-codeowners-1")},
+	}
+	result, err := f.config(t).createCommit(context.Background(), &commitOptions{
+		RepoOwner:       "o",
+		RepoName:        "r",
+		Branch:          "main",
+		CommitMessage:   "Updating CODEOWNERS file",
+		Mode:            commitModeReview,
+		PullRequest:     pr,
+		PullRequestBody: "new body",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "new body", result.PullRequest.GetBody())
+	assert.Equal(t, map[string]interface{}{"sha": "new-commit", "force": true}, update)
+	assert.Equal(t, map[string]interface{}{"title": "Updating CODEOWNERS file", "body": "new body"}, edit)
+	assert.False(t, f.made("POST /repos/o/r/pulls"))
+}
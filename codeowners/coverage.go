@@ -0,0 +1,159 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/form3tech-oss/go-github-utils/pkg/branch"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+// coverage describes how many of the files of a repository have owners.
+type coverage struct {
+	Total       int
+	Unowned     []string
+	OwnerCounts map[string]int
+}
+
+// percentage returns the share of files with owners, as a percentage.
+func (c *coverage) percentage() float64 {
+	if c.Total == 0 {
+		return 100
+	}
+	return float64(c.Total-len(c.Unowned)) * 100 / float64(c.Total)
+}
+
+// ownersMatcher resolves the owners of files, compiling the patterns of the rules and sections once for all of them.
+type ownersMatcher struct {
+	rules    Ruleset
+	sections []Section
+	matchers []rulesetMatcher
+}
+
+func newOwnersMatcher(rules Ruleset, sections []Section) *ownersMatcher {
+	m := &ownersMatcher{rules: rules, sections: sections, matchers: []rulesetMatcher{rules.matcher()}}
+	for _, section := range sections {
+		m.matchers = append(m.matchers, section.Rules.matcher())
+	}
+	return m
+}
+
+// owners returns the owners of the file at the given path. Every GitLab section applies independently, so the owners
+// of the section's matching rule, or its default owners, are added to those of the rules.
+func (m *ownersMatcher) owners(path string) []string {
+	var owners []string
+	if i := m.matchers[0].match(path); i != -1 {
+		owners = append(owners, m.rules[i].Usernames...)
+	}
+	for j, section := range m.sections {
+		i := m.matchers[j+1].match(path)
+		if i == -1 {
+			continue
+		}
+		if len(section.Rules[i].Usernames) > 0 {
+			owners = append(owners, section.Rules[i].Usernames...)
+		} else {
+			owners = append(owners, section.DefaultOwners...)
+		}
+	}
+	return owners
+}
+
+// measureCoverage measures how many of the paths have owners.
+func measureCoverage(rules Ruleset, sections []Section, paths []string) *coverage {
+	c := &coverage{Total: len(paths), OwnerCounts: map[string]int{}}
+	matcher := newOwnersMatcher(rules, sections)
+	for _, path := range paths {
+		owners := matcher.owners(path)
+		if len(owners) == 0 {
+			c.Unowned = append(c.Unowned, path)
+			continue
+		}
+		seen := map[string]bool{}
+		for _, owner := range owners {
+			owner = compileOwner(owner)
+			if !seen[owner] {
+				seen[owner] = true
+				c.OwnerCounts[owner]++
+			}
+		}
+	}
+	sort.Strings(c.Unowned)
+	return c
+}
+
+// getFilePaths returns the paths of every file on the branch of the repository.
+func getFilePaths(ctx context.Context, config *providerConfiguration, owner, repo, branchName string) ([]string, error) {
+	sha, err := branch.GetSHAForBranch(ctx, config.client, owner, repo, branchName)
+	if err != nil {
+		return nil, err
+	}
+	tree, _, err := config.client.Git.GetTree(ctx, owner, repo, sha, true)
+	if err != nil {
+		return nil, err
+	}
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("the tree of %s/%s is too large to be listed in full by GitHub", owner, repo)
+	}
+	var paths []string
+	for _, entry := range tree.Entries {
+		if entry.GetType() == "blob" {
+			paths = append(paths, entry.GetPath())
+		}
+	}
+	return paths, nil
+}
+
+// minimumCoverageDiff fails the plan if the planned rules leave a larger share of the files of the repository
+// without owners than minimum_coverage allows.
+func minimumCoverageDiff(d *schema.ResourceDiff, m interface{}) error {
+	minimum := d.Get("minimum_coverage").(float64)
+	if minimum <= 0 {
+		return nil
+	}
+	for _, key := range []string{"repository_owner", "repository_name", "branch", "path", "managed_section", "rules", "section"} {
+		if !d.NewValueKnown(key) {
+			return nil
+		}
+	}
+
+	config := m.(*providerConfiguration)
+	ctx := context.Background()
+
+	file := &File{
+		RepositoryOwner: d.Get("repository_owner").(string),
+		RepositoryName:  d.Get("repository_name").(string),
+		Branch:          d.Get("branch").(string),
+		Path:            d.Get("path").(string),
+		ManagedSection:  d.Get("managed_section").(string),
+		Dialect:         d.Get("dialect").(string),
+		Ruleset:         expandRuleset(d.Get("rules").([]interface{})),
+		Sections:        expandSections(d.Get("section").([]interface{})),
+	}
+	if file.Branch == "" {
+		rep, _, err := config.client.Repositories.Get(ctx, file.RepositoryOwner, file.RepositoryName)
+		if err != nil {
+			return err
+		}
+		file.Branch = rep.GetDefaultBranch()
+	}
+
+	paths, err := getFilePaths(ctx, config, file.RepositoryOwner, file.RepositoryName, file.Branch)
+	if err != nil {
+		return err
+	}
+
+	// Rules outside of the managed section apply too, so the coverage is that of the file as it would be written.
+	existing, _, err := getRemoteContent(ctx, config, file)
+	if err != nil {
+		return err
+	}
+	rules, sections, _ := parseCodeowners(file.render(existing), file.Dialect)
+
+	c := measureCoverage(rules, sections, paths)
+	if c.percentage() < minimum {
+		return fmt.Errorf("the rules leave %d of %d files without owners, a coverage of %.1f%% below the minimum of %.1f%%", len(c.Unowned), c.Total, c.percentage(), minimum)
+	}
+	return nil
+}
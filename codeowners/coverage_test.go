@@ -0,0 +1,61 @@
+package codeowners
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasureCoverage(t *testing.T) {
+	rules := Ruleset{
+		{Pattern: "*.go", Usernames: []string{"gopher", "my-org/backend"}},
+		{Pattern: "/docs/", Usernames: []string{"writer@example.com"}},
+		{Pattern: "/docs/generated/"},
+	}
+	paths := []string{"main.go", "cmd/app/main.go", "docs/index.md", "docs/generated/api.md", "README.md"}
+
+	c := measureCoverage(rules, nil, paths)
+	assert.Equal(t, 5, c.Total)
+	assert.Equal(t, []string{"README.md", "docs/generated/api.md"}, c.Unowned)
+	assert.Equal(t, map[string]int{"@gopher": 2, "@my-org/backend": 2, "writer@example.com": 1}, c.OwnerCounts)
+	assert.InDelta(t, 60, c.percentage(), 0.001)
+
+	assert.Equal(t, float64(100), measureCoverage(rules, nil, nil).percentage())
+}
+
+func TestOwnersMatcherWithSections(t *testing.T) {
+	rules := Ruleset{{Pattern: "*", Usernames: []string{"expert"}}}
+	sections := []Section{
+		{Name: "Docs", DefaultOwners: []string{"writers"}, Rules: Ruleset{{Pattern: "*.md"}}},
+		{Name: "Go", Rules: Ruleset{{Pattern: "*.go", Usernames: []string{"gopher"}}}},
+	}
+
+	m := newOwnersMatcher(rules, sections)
+	assert.Equal(t, []string{"expert", "writers"}, m.owners("README.md"))
+	assert.Equal(t, []string{"expert", "gopher"}, m.owners("main.go"))
+	assert.Empty(t, newOwnersMatcher(nil, sections).owners("Makefile"))
+}
+
+func TestGetFilePaths(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/r/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+	f.handle("/repos/o/r/git/trees/head", http.StatusOK, `{"sha": "head", "tree": [
+		{"path": "docs", "type": "tree"},
+		{"path": "docs/index.md", "type": "blob"},
+		{"path": "main.go", "type": "blob"},
+		{"path": "vendor/lib", "type": "commit"}
+	]}`)
+	f.handle("/repos/o/r/git/ref/heads/big", http.StatusOK, `{"ref": "refs/heads/big", "object": {"sha": "big"}}`)
+	f.handle("/repos/o/r/git/trees/big", http.StatusOK, `{"sha": "big", "tree": [], "truncated": true}`)
+	config := f.config(t)
+
+	paths, err := getFilePaths(context.Background(), config, "o", "r", "main")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs/index.md", "main.go"}, paths)
+
+	_, err = getFilePaths(context.Background(), config, "o", "r", "big")
+	assert.Error(t, err)
+}
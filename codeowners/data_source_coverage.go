@@ -0,0 +1,104 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func dataSourceCoverage() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceCoverageRead,
+		Schema: map[string]*schema.Schema{
+			"repository_owner": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The repository owner e.g. my-org if the repo is my-org/my-repo",
+			},
+			"repository_name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The repository name e.g. my-repo",
+			},
+			"branch": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The branch to measure the coverage of - defaults to the default repo branch",
+				Default:     "",
+			},
+			"path": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The location of the CODEOWNERS file - defaults to the one GitHub uses",
+			},
+			"total_files": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The number of files in the repository",
+			},
+			"unowned_paths": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The paths of the files without owners",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"owner_file_counts": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "The number of files owned by each owner",
+				Elem: &schema.Schema{
+					Type: schema.TypeInt,
+				},
+			},
+			"coverage": {
+				Type:        schema.TypeFloat,
+				Computed:    true,
+				Description: "The percentage of files with owners",
+			},
+		},
+	}
+}
+
+func dataSourceCoverageRead(d *schema.ResourceData, m interface{}) error {
+	config := m.(*providerConfiguration)
+	ctx := context.Background()
+
+	file := &File{
+		RepositoryOwner: d.Get("repository_owner").(string),
+		RepositoryName:  d.Get("repository_name").(string),
+		Branch:          d.Get("branch").(string),
+		Path:            d.Get("path").(string),
+	}
+	if file.Branch == "" {
+		rep, _, err := config.client.Repositories.Get(ctx, file.RepositoryOwner, file.RepositoryName)
+		if err != nil {
+			return err
+		}
+		file.Branch = rep.GetDefaultBranch()
+	}
+
+	rules, err := getRemoteRuleset(ctx, config, file)
+	if err != nil {
+		return err
+	}
+	paths, err := getFilePaths(ctx, config, file.RepositoryOwner, file.RepositoryName, file.Branch)
+	if err != nil {
+		return err
+	}
+	c := measureCoverage(rules, nil, paths)
+
+	d.SetId(fmt.Sprintf("%s/%s:%s", file.RepositoryOwner, file.RepositoryName, d.Get("branch").(string)))
+	if err := d.Set("total_files", c.Total); err != nil {
+		return err
+	}
+	if err := d.Set("unowned_paths", c.Unowned); err != nil {
+		return err
+	}
+	if err := d.Set("owner_file_counts", c.OwnerCounts); err != nil {
+		return err
+	}
+	return d.Set("coverage", c.percentage())
+}
@@ -0,0 +1,122 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/google/go-github/v54/github"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func dataSourceErrors() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceErrorsRead,
+		Schema: map[string]*schema.Schema{
+			"repository_owner": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The repository owner e.g. my-org if the repo is my-org/my-repo",
+			},
+			"repository_name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The repository name e.g. my-repo",
+			},
+			"ref": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The branch, tag or commit to check the CODEOWNERS file of - defaults to the default repo branch",
+				Default:     "",
+			},
+			"errors": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The errors GitHub reports for the CODEOWNERS file",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"line": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"column": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"kind": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"source": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"suggestion": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"message": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"path": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceErrorsRead(d *schema.ResourceData, m interface{}) error {
+	config := m.(*providerConfiguration)
+
+	owner := d.Get("repository_owner").(string)
+	repo := d.Get("repository_name").(string)
+	ref := d.Get("ref").(string)
+
+	codeownersErrors, err := getCodeownersErrors(context.Background(), config, owner, repo, ref)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s:%s", owner, repo, ref))
+	return d.Set("errors", flattenCodeownersErrors(codeownersErrors))
+}
+
+// getCodeownersErrors returns the errors GitHub reports for the CODEOWNERS file at the given ref, or on the default
+// branch if the ref is empty.
+func getCodeownersErrors(ctx context.Context, config *providerConfiguration, owner, repo, ref string) ([]*github.CodeownersError, error) {
+	// The client doesn't support the ref parameter, so the request is made by hand.
+	u := fmt.Sprintf("repos/%v/%v/codeowners/errors", owner, repo)
+	if ref != "" {
+		u += "?ref=" + url.QueryEscape(ref)
+	}
+	req, err := config.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	codeownersErrors := &github.CodeownersErrors{}
+	if _, err := config.client.Do(ctx, req, codeownersErrors); err != nil {
+		return nil, fmt.Errorf("failed to retrieve the CODEOWNERS errors of %s/%s: %v", owner, repo, err)
+	}
+	return codeownersErrors.Errors, nil
+}
+
+func flattenCodeownersErrors(in []*github.CodeownersError) []interface{} {
+	out := make([]interface{}, 0, len(in))
+	for _, e := range in {
+		out = append(out, map[string]interface{}{
+			"line":       e.Line,
+			"column":     e.Column,
+			"kind":       e.Kind,
+			"source":     e.Source,
+			"suggestion": e.GetSuggestion(),
+			"message":    e.Message,
+			"path":       e.Path,
+		})
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCodeownersErrors = `{"errors": [
+	{"line": 2, "column": 7, "kind": "Unknown owner", "source": "*.go @typo", "message": "Unknown owner on line 2", "path": ".github/CODEOWNERS"},
+	{"line": 1, "column": 1, "kind": "Invalid pattern", "source": "!*.md @writer", "message": "Invalid pattern on line 1", "path": "docs/CODEOWNERS"}
+]}`
+
+func TestGetCodeownersErrors(t *testing.T) {
+	f := newFakeGitHub(t)
+	var ref string
+	f.mux.HandleFunc("/repos/o/r/codeowners/errors", func(w http.ResponseWriter, r *http.Request) {
+		ref = r.URL.Query().Get("ref")
+		fmt.Fprint(w, testCodeownersErrors)
+	})
+
+	codeownersErrors, err := getCodeownersErrors(context.Background(), f.config(t), "o", "r", "feature/x")
+	require.NoError(t, err)
+	assert.Equal(t, "feature/x", ref)
+	require.Len(t, codeownersErrors, 2)
+	assert.Equal(t, 2, codeownersErrors[0].Line)
+	assert.Equal(t, "Unknown owner", codeownersErrors[0].Kind)
+
+	flattened := flattenCodeownersErrors(codeownersErrors)
+	assert.Equal(t, 7, flattened[0].(map[string]interface{})["column"])
+}
+
+func TestCheckFileErrors(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/r/codeowners/errors", http.StatusOK, testCodeownersErrors)
+	config := f.config(t)
+
+	file := &File{RepositoryOwner: "o", RepositoryName: "r", Branch: "main", Path: ".github/CODEOWNERS"}
+	assert.EqualError(t, checkFileErrors(context.Background(), config, file),
+		"GitHub reports errors for .github/CODEOWNERS:\n  line 2, column 7: Unknown owner: *.go @typo")
+
+	// Errors for other files are ignored.
+	file.Path = "CODEOWNERS"
+	assert.NoError(t, checkFileErrors(context.Background(), config, file))
+}
+
+func TestRevertFile(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handleCommit()
+	f.handle("/repos/o/r/git/refs/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "new-commit"}}`)
+
+	config := f.config(t)
+	file := &File{RepositoryOwner: "o", RepositoryName: "r", Branch: "main", Path: ".github/CODEOWNERS"}
+	options := &commitOptions{RepoOwner: "o", RepoName: "r", Branch: "main", Mode: commitModePush}
+
+	require.NoError(t, revertFile(context.Background(), config, options, file, "* @expert\n", true))
+	assert.True(t, f.made("PATCH /repos/o/r/git/refs/heads/main"))
+}
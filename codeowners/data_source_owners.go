@@ -0,0 +1,166 @@
+package codeowners
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func dataSourceOwners() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceOwnersRead,
+		Schema: map[string]*schema.Schema{
+			"repository_owner": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The repository owner e.g. my-org if the repo is my-org/my-repo",
+				RequiredWith:  []string{"repository_name"},
+				ConflictsWith: []string{"rules"},
+			},
+			"repository_name": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The repository name e.g. my-repo",
+				RequiredWith:  []string{"repository_owner"},
+				ConflictsWith: []string{"rules"},
+			},
+			"branch": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The branch to read the CODEOWNERS file from - defaults to the default repo branch",
+				Default:       "",
+				ConflictsWith: []string{"rules"},
+			},
+			"path": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The location of the CODEOWNERS file - defaults to the one GitHub uses",
+				ConflictsWith: []string{"rules"},
+			},
+			"rules": {
+				Type:         schema.TypeList,
+				ConfigMode:   schema.SchemaConfigModeAttr,
+				Optional:     true,
+				Description:  "Rules to resolve the owners with, instead of those of a repository",
+				Elem:         ruleResource(false),
+				ExactlyOneOf: []string{"rules", "repository_name"},
+			},
+			"paths": {
+				Type:        schema.TypeList,
+				Required:    true,
+				Description: "The paths of the files to resolve the owners of, relative to the root of the repository",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"owners": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The owners of each of the paths",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"owners": {
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"rule_index": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "The index of the rule which applies to the path, or -1 if none does",
+						},
+						"pattern": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceOwnersRead(d *schema.ResourceData, m interface{}) error {
+	config := m.(*providerConfiguration)
+
+	var rules Ruleset
+	var id string
+	if raw, ok := d.GetOk("rules"); ok {
+		rules = expandRuleset(raw.([]interface{}))
+		id = fmt.Sprintf("%x", sha256.Sum256(rules.Compile()))
+	} else {
+		file := &File{
+			RepositoryOwner: d.Get("repository_owner").(string),
+			RepositoryName:  d.Get("repository_name").(string),
+			Branch:          d.Get("branch").(string),
+			Path:            d.Get("path").(string),
+		}
+		var err error
+		if rules, err = getRemoteRuleset(context.Background(), config, file); err != nil {
+			return err
+		}
+		id = fmt.Sprintf("%s/%s:%s", file.RepositoryOwner, file.RepositoryName, file.Branch)
+	}
+
+	var owners []interface{}
+	matcher := rules.matcher()
+	for _, p := range d.Get("paths").([]interface{}) {
+		path := p.(string)
+		i := matcher.match(path)
+		resolved := map[string]interface{}{
+			"path":       path,
+			"owners":     []interface{}{},
+			"rule_index": i,
+			"pattern":    "",
+		}
+		if i != -1 {
+			var ruleOwners []interface{}
+			for _, owner := range rules[i].Usernames {
+				ruleOwners = append(ruleOwners, compileOwner(owner))
+			}
+			resolved["owners"] = ruleOwners
+			resolved["pattern"] = rules[i].Pattern
+		}
+		owners = append(owners, resolved)
+	}
+
+	d.SetId(id)
+	return d.Set("owners", owners)
+}
+
+// getRemoteRuleset returns the rules of the CODEOWNERS file, which is the one GitHub uses unless the file has a path.
+func getRemoteRuleset(ctx context.Context, config *providerConfiguration, file *File) (Ruleset, error) {
+	if file.Path == "" {
+		p, err := findCodeownersFile(ctx, config, file, codeownersPaths)
+		if err != nil {
+			return nil, err
+		}
+		if p == "" {
+			return nil, fmt.Errorf("no CODEOWNERS file found in %s/%s", file.RepositoryOwner, file.RepositoryName)
+		}
+		file.Path = p
+	}
+
+	content, exists, err := getRemoteContent(ctx, config, file)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s not found in %s/%s", file.Path, file.RepositoryOwner, file.RepositoryName)
+	}
+
+	rules, err := parseRulesFile(content)
+	if err != nil {
+		log.Printf("[WARN] skipped lines of %s which could not be interpreted: %v", file.Path, err)
+	}
+	return rules, nil
+}
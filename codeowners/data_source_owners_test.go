@@ -0,0 +1,30 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataSourceOwnersReadInlineRules(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, dataSourceOwners().Schema, map[string]interface{}{
+		"rules": []interface{}{
+			map[string]interface{}{"pattern": "*", "usernames": []interface{}{"expert"}},
+			map[string]interface{}{"pattern": "*.go", "usernames": []interface{}{"my-org/gophers", "gopher@example.com"}},
+		},
+		"paths": []interface{}{"README.md", "cmd/main.go"},
+	})
+
+	require.NoError(t, dataSourceOwnersRead(d, &providerConfiguration{}))
+
+	assert.NotEmpty(t, d.Id())
+	assert.Equal(t, "README.md", d.Get("owners.0.path"))
+	assert.Equal(t, []interface{}{"@expert"}, d.Get("owners.0.owners"))
+	assert.Equal(t, 0, d.Get("owners.0.rule_index"))
+	assert.Equal(t, "cmd/main.go", d.Get("owners.1.path"))
+	assert.Equal(t, []interface{}{"gopher@example.com", "@my-org/gophers"}, d.Get("owners.1.owners"))
+	assert.Equal(t, 1, d.Get("owners.1.rule_index"))
+	assert.Equal(t, "*.go", d.Get("owners.1.pattern"))
+}
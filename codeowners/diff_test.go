@@ -0,0 +1,36 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRulesets(t *testing.T) {
+	before := Ruleset{
+		{Pattern: "*", Usernames: []string{"expert"}},
+		{Pattern: "*.java", Usernames: []string{"java-expert"}},
+		{Pattern: "*.md", Usernames: []string{"writer"}},
+	}
+	after := Ruleset{
+		{Pattern: "*", Usernames: []string{"expert"}},
+		{Pattern: "*.go", Usernames: []string{"go-expert"}},
+		{Pattern: "*.java", Usernames: []string{"java-expert", "java-guru"}},
+		{Pattern: "*.md", Usernames: []string{"writer"}},
+	}
+
+	expected := "  * @expert\n" +
+		"- *.java @java-expert\n" +
+		"+ *.go @go-expert\n" +
+		"+ *.java @java-expert @java-guru\n" +
+		"  *.md @writer\n"
+	assert.Equal(t, expected, diffRulesets(before, after))
+}
+
+func TestDiffRulesetsFromNothing(t *testing.T) {
+	after := Ruleset{
+		{Pattern: "*", Usernames: []string{"expert"}},
+	}
+	assert.Equal(t, "+ * @expert\n", diffRulesets(nil, after))
+	assert.Equal(t, "- * @expert\n", diffRulesets(after, nil))
+}
@@ -0,0 +1,54 @@
+package codeowners
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// headerData is made available to the header and footer templates.
+type headerData struct {
+	RepositoryOwner string
+	RepositoryName  string
+	Branch          string
+	Path            string
+	Variables       map[string]string
+}
+
+func validateHeaderTemplate(v interface{}, k string) ([]string, []error) {
+	if _, err := template.New(k).Parse(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%s is not a valid template: %v", k, err)}
+	}
+	return nil, nil
+}
+
+// render returns the format with its header and footer templates rendered for the file.
+func (format Format) render(file *File) (Format, error) {
+	data := &headerData{
+		RepositoryOwner: file.RepositoryOwner,
+		RepositoryName:  file.RepositoryName,
+		Branch:          file.Branch,
+		Path:            file.Path,
+		Variables:       format.Variables,
+	}
+	var err error
+	if format.Header, err = renderHeaderTemplate("header", format.Header, data); err != nil {
+		return format, err
+	}
+	if format.Footer, err = renderHeaderTemplate("footer", format.Footer, data); err != nil {
+		return format, err
+	}
+	return format, nil
+}
+
+func renderHeaderTemplate(name, text string, data *headerData) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s template: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %v", name, err)
+	}
+	return buf.String(), nil
+}
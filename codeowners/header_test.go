@@ -0,0 +1,50 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderFormat(t *testing.T) {
+	file := &File{RepositoryOwner: "my-org", RepositoryName: "my-repo", Branch: "main", Path: ".github/CODEOWNERS"}
+	format := Format{
+		Header:    "managed by {{ .Variables.workspace }} for {{ .RepositoryOwner }}/{{ .RepositoryName }}\nsee {{ .Variables.source }}",
+		Footer:    "{{ .Path }} on {{ .Branch }}",
+		Variables: map[string]string{"workspace": "production", "source": "https://example.com/terraform"},
+	}
+
+	rendered, err := format.render(file)
+	require.NoError(t, err)
+	assert.Equal(t, "managed by production for my-org/my-repo\nsee https://example.com/terraform", rendered.Header)
+	assert.Equal(t, ".github/CODEOWNERS on main", rendered.Footer)
+
+	_, err = Format{Header: "{{ .Variables.missing }}"}.render(file)
+	assert.Error(t, err)
+}
+
+func TestCompileHeaderAndFooter(t *testing.T) {
+	file := &File{
+		Ruleset: Ruleset{{Pattern: "*", Usernames: []string{"expert"}}},
+		Format:  Format{Header: "managed by production\nsee https://example.com/terraform", Footer: "end of file"},
+	}
+	compiled := string(file.compile())
+	assert.Equal(t, "# managed by production\n# see https://example.com/terraform\n\n* @expert\n\n# end of file\n", compiled)
+
+	rules, err := parseRulesFile(compiled)
+	require.NoError(t, err)
+	assert.Equal(t, file.Ruleset, rules)
+
+	// An empty header renders none.
+	file.Format = Format{}
+	assert.Equal(t, "* @expert\n", string(file.compile()))
+}
+
+func TestValidateHeaderTemplate(t *testing.T) {
+	_, errs := validateHeaderTemplate("managed by {{ .Variables.workspace }}", "format.0.header")
+	assert.Empty(t, errs)
+
+	_, errs = validateHeaderTemplate("{{ .Variables ", "format.0.header")
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,157 @@
+package codeowners
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+const (
+	lintLevelOff   = "off"
+	lintLevelWarn  = "warn"
+	lintLevelError = "error"
+)
+
+var lintLevels = []string{lintLevelOff, lintLevelWarn, lintLevelError}
+
+// wildcard stands in for the characters matched by wildcards when building the paths a pattern matches. No pattern
+// can contain it, so only the wildcards of another pattern can match it.
+const wildcard = "￿"
+
+// lintFinding is a problem found with a rule.
+type lintFinding struct {
+	Pattern string
+	Message string
+}
+
+func (f lintFinding) String() string {
+	return fmt.Sprintf("rule %q %s", f.Pattern, f.Message)
+}
+
+// lintRuleset looks for rules which have no effect or are likely mistakes: rules overridden by a later rule with
+// the same pattern or one matching everything they match, since the last matching rule wins, and rules without
+// owners, which unset the ownership of the files they match.
+func lintRuleset(rules Ruleset) []lintFinding {
+	var findings []lintFinding
+	for i, rule := range rules {
+		if len(rule.Usernames) == 0 {
+			findings = append(findings, lintFinding{Pattern: rule.Pattern, Message: "has no owners, which unsets the ownership of the files it matches"})
+		}
+		for _, later := range rules[i+1:] {
+			if later.Pattern == rule.Pattern {
+				findings = append(findings, lintFinding{Pattern: rule.Pattern, Message: "is duplicated by a later rule, which takes precedence"})
+				break
+			}
+			if patternCovers(later.Pattern, rule.Pattern) {
+				findings = append(findings, lintFinding{Pattern: rule.Pattern, Message: fmt.Sprintf("is unreachable, as the later rule %q matches every file it matches", later.Pattern)})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// patternCovers returns whether the pattern matches every file the other pattern matches. This is checked against
+// sample paths matched by the other pattern, with wildcards standing in for varying lengths of any characters, so
+// the answer is a close approximation rather than a proof.
+func patternCovers(pattern, other string) bool {
+	m, err := newPatternMatcher(pattern)
+	if err != nil {
+		return false
+	}
+	for _, path := range samplePaths(other) {
+		if !m.match(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// samplePaths returns paths of files matched by the pattern, using varying lengths of the wildcard character in
+// place of wildcards.
+func samplePaths(pattern string) []string {
+	dir := strings.HasSuffix(pattern, "/")
+	p := strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "/")
+	// Patterns without a slash other than a trailing one match at any depth.
+	anywhere := !strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+
+	var paths []string
+	for _, n := range []int{1, 3} {
+		for _, deep := range []string{deepPath(n), ""} {
+			// "**" matches any number of directories, including none when followed by a slash.
+			sample := strings.NewReplacer("**/", deep+"/", "**", deepPath(n), "*", strings.Repeat(wildcard, n), "?", wildcard).Replace(p)
+			sample = strings.TrimPrefix(strings.ReplaceAll(sample, "//", "/"), "/")
+
+			var candidates []string
+			if !strings.HasSuffix(pattern, "*") {
+				// The pattern may match a directory, so files deep within it are matched too.
+				candidates = append(candidates, sample+"/"+deepPath(n))
+			}
+			if !dir {
+				candidates = append(candidates, sample)
+			}
+			if anywhere {
+				for _, c := range candidates {
+					candidates = append(candidates, deepPath(n)+"/"+c)
+				}
+			}
+			paths = append(paths, candidates...)
+		}
+	}
+	return paths
+}
+
+// deepPath returns a path of n directories named after the wildcard character.
+func deepPath(n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = wildcard
+	}
+	return strings.Join(parts, "/")
+}
+
+// lintFile lints the rules of the file, and of each of its sections separately.
+func lintFile(file *File) []lintFinding {
+	findings := lintRuleset(file.Ruleset)
+	for _, section := range file.Sections {
+		for _, f := range lintRuleset(section.Rules) {
+			if len(section.DefaultOwners) > 0 && strings.HasPrefix(f.Message, "has no owners") {
+				continue
+			}
+			f.Message = fmt.Sprintf("in section %q %s", section.Name, f.Message)
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// lintDiff reports the findings of linting the planned rules as warnings or errors, depending on lint_level.
+func lintDiff(d *schema.ResourceDiff) error {
+	level := d.Get("lint_level").(string)
+	if level == lintLevelOff || !d.NewValueKnown("rules") || !d.NewValueKnown("section") {
+		return nil
+	}
+
+	file := &File{
+		Ruleset:  expandRuleset(d.Get("rules").([]interface{})),
+		Sections: expandSections(d.Get("section").([]interface{})),
+	}
+	findings := lintFile(file)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(findings))
+	for i, f := range findings {
+		messages[i] = f.String()
+	}
+	if level == lintLevelError {
+		return fmt.Errorf("lint failed:\n  %s", strings.Join(messages, "\n  "))
+	}
+	for _, message := range messages {
+		log.Printf("[WARN] %s", message)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatternCovers(t *testing.T) {
+	tests := []struct {
+		pattern string
+		other   string
+		covers  bool
+	}{
+		{pattern: "*", other: "*.go", covers: true},
+		{pattern: "*", other: "/docs/", covers: true},
+		{pattern: "*.go", other: "/cmd/*.go", covers: true},
+		{pattern: "*.go", other: "main.go", covers: true},
+		{pattern: "/docs/", other: "/docs/*", covers: true},
+		{pattern: "docs/", other: "/docs/api/", covers: true},
+		{pattern: "/docs/", other: "docs/", covers: false},
+		{pattern: "**/docs/", other: "/docs/api/", covers: true},
+		{pattern: "/docs/*", other: "/docs/", covers: false},
+		{pattern: "*.go", other: "*", covers: false},
+		{pattern: "main.go", other: "*.go", covers: false},
+		{pattern: "*.js", other: "*.go", covers: false},
+		{pattern: "/src/", other: "*.go", covers: false},
+		{pattern: "a?", other: "a*", covers: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" covers "+test.other, func(t *testing.T) {
+			assert.Equal(t, test.covers, patternCovers(test.pattern, test.other))
+		})
+	}
+}
+
+func TestLintRuleset(t *testing.T) {
+	findings := lintRuleset(Ruleset{
+		{Pattern: "*.go", Usernames: []string{"gopher"}},
+		{Pattern: "/docs/", Usernames: []string{"writer"}},
+		{Pattern: "/vendor/"},
+		{Pattern: "/docs/", Usernames: []string{"editor"}},
+		{Pattern: "*", Usernames: []string{"expert"}},
+	})
+
+	assert.Equal(t, []lintFinding{
+		{Pattern: "*.go", Message: `is unreachable, as the later rule "*" matches every file it matches`},
+		{Pattern: "/docs/", Message: "is duplicated by a later rule, which takes precedence"},
+		{Pattern: "/vendor/", Message: "has no owners, which unsets the ownership of the files it matches"},
+		{Pattern: "/vendor/", Message: `is unreachable, as the later rule "*" matches every file it matches`},
+		{Pattern: "/docs/", Message: `is unreachable, as the later rule "*" matches every file it matches`},
+	}, findings)
+
+	assert.Empty(t, lintRuleset(Ruleset{
+		{Pattern: "*", Usernames: []string{"expert"}},
+		{Pattern: "*.go", Usernames: []string{"gopher"}},
+		{Pattern: "/docs/", Usernames: []string{"writer"}},
+	}))
+}
+
+func TestLintFileSections(t *testing.T) {
+	findings := lintFile(&File{
+		Ruleset: Ruleset{{Pattern: "*", Usernames: []string{"expert"}}},
+		Sections: []Section{
+			{Name: "Docs", DefaultOwners: []string{"writers"}, Rules: Ruleset{{Pattern: "docs/"}, {Pattern: "docs/"}}},
+		},
+	})
+
+	assert.Equal(t, []lintFinding{
+		{Pattern: "docs/", Message: `in section "Docs" is duplicated by a later rule, which takes precedence`},
+	}, findings)
+}
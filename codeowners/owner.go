@@ -0,0 +1,81 @@
+package codeowners
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ownerKind is the kind of an owner in a CODEOWNERS file.
+type ownerKind int
+
+const (
+	ownerKindUser ownerKind = iota
+	ownerKindTeam
+	ownerKindEmail
+)
+
+func (k ownerKind) String() string {
+	switch k {
+	case ownerKindTeam:
+		return "team"
+	case ownerKindEmail:
+		return "email"
+	default:
+		return "user"
+	}
+}
+
+var (
+	userOwnerRegexp  = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	teamOwnerRegexp  = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)+$`)
+	emailOwnerRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+// classifyOwner returns the kind of the owner. Users and teams may or may not have the "@" prefix, while email
+// addresses never do.
+func classifyOwner(owner string) (ownerKind, error) {
+	if strings.Contains(owner, "@") && !strings.HasPrefix(owner, "@") {
+		if !emailOwnerRegexp.MatchString(owner) {
+			return ownerKindEmail, fmt.Errorf("%q is not a valid email address", owner)
+		}
+		return ownerKindEmail, nil
+	}
+	name := strings.TrimPrefix(owner, "@")
+	switch {
+	case userOwnerRegexp.MatchString(name):
+		return ownerKindUser, nil
+	case teamOwnerRegexp.MatchString(name):
+		return ownerKindTeam, nil
+	}
+	return ownerKindUser, fmt.Errorf("%q is not a valid owner - expected @username, @org/team-name or an email address", owner)
+}
+
+// normaliseOwner returns the owner in the form it is kept in state: users and teams without the "@" prefix, and
+// email addresses as they are.
+func normaliseOwner(owner string) string {
+	if kind, _ := classifyOwner(owner); kind == ownerKindEmail {
+		return owner
+	}
+	return strings.TrimPrefix(owner, "@")
+}
+
+// compileOwner returns the owner in the form it takes in a CODEOWNERS file.
+func compileOwner(owner string) string {
+	if kind, _ := classifyOwner(owner); kind == ownerKindEmail || strings.HasPrefix(owner, "@") {
+		return owner
+	}
+	return "@" + owner
+}
+
+// validateOwner is a schema.SchemaValidateFunc checking that an owner is a user, a team or an email address.
+func validateOwner(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if _, err := classifyOwner(v); err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+	return nil, nil
+}
@@ -0,0 +1,47 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyOwner(t *testing.T) {
+	tests := []struct {
+		owner    string
+		expected ownerKind
+		valid    bool
+	}{
+		{owner: "jim", expected: ownerKindUser, valid: true},
+		{owner: "@jim", expected: ownerKindUser, valid: true},
+		{owner: "my-org/my-team", expected: ownerKindTeam, valid: true},
+		{owner: "@my-org/my-team", expected: ownerKindTeam, valid: true},
+		{owner: "jim@example.com", expected: ownerKindEmail, valid: true},
+		{owner: "jim.bob+codeowners@mail.example.com", expected: ownerKindEmail, valid: true},
+		{owner: "@jim@example.com", valid: false},
+		{owner: "jim@example", valid: false},
+		{owner: "@", valid: false},
+		{owner: "my-org/", valid: false},
+		{owner: "jim bob", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.owner, func(t *testing.T) {
+			kind, err := classifyOwner(test.owner)
+			if !test.valid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, kind)
+		})
+	}
+}
+
+func TestOwnerRoundTrip(t *testing.T) {
+	ruleset, err := parseRulesFile("*.go @jim @my-org/gophers jim@example.com\n")
+	require.NoError(t, err)
+	assert.Equal(t, Ruleset{{Pattern: "*.go", Usernames: []string{"jim", "my-org/gophers", "jim@example.com"}}}, ruleset)
+	assert.Equal(t, "*.go @jim @my-org/gophers jim@example.com", ruleset[0].Compile())
+}
@@ -0,0 +1,146 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+// ownerCheckCache caches the result of checking an owner's access to a repository, so that each owner is only
+// resolved once per provider instance however many rules it appears in.
+type ownerCheckCache struct {
+	mu      sync.Mutex
+	results map[string]error
+}
+
+func newOwnerCheckCache() *ownerCheckCache {
+	return &ownerCheckCache{results: map[string]error{}}
+}
+
+func (c *ownerCheckCache) get(key string) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err, ok := c.results[key]
+	return ok, err
+}
+
+func (c *ownerCheckCache) set(key string, err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[key] = err
+}
+
+// checkOwner checks that the owner exists and has write access to the repository. Email addresses cannot be
+// resolved to a user, so they are not checked.
+func (c *providerConfiguration) checkOwner(ctx context.Context, repoOwner, repoName, owner string) error {
+	key := fmt.Sprintf("%s/%s:%s", repoOwner, repoName, owner)
+	if ok, err := c.ownerChecks.get(key); ok {
+		return err
+	}
+
+	var err error
+	kind, _ := classifyOwner(owner)
+	name := strings.TrimPrefix(owner, "@")
+	switch kind {
+	case ownerKindUser:
+		err = c.checkUserOwner(ctx, repoOwner, repoName, name)
+	case ownerKindTeam:
+		err = c.checkTeamOwner(ctx, repoOwner, repoName, name)
+	}
+
+	c.ownerChecks.set(key, err)
+	return err
+}
+
+func (c *providerConfiguration) checkUserOwner(ctx context.Context, repoOwner, repoName, user string) error {
+	level, resp, err := c.client.Repositories.GetPermissionLevel(ctx, repoOwner, repoName, user)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("user @%s does not exist", user)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check the permissions of @%s: %v", user, err)
+	}
+	switch level.GetPermission() {
+	case "admin", "maintain", "write":
+		return nil
+	}
+	return fmt.Errorf("user @%s does not have write access to %s/%s", user, repoOwner, repoName)
+}
+
+func (c *providerConfiguration) checkTeamOwner(ctx context.Context, repoOwner, repoName, team string) error {
+	org, slug := team, ""
+	if i := strings.Index(team, "/"); i != -1 {
+		org, slug = team[:i], team[i+1:]
+	}
+	repo, resp, err := c.client.Teams.IsTeamRepoBySlug(ctx, org, slug, repoOwner, repoName)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("team @%s does not exist, is not visible or has no access to %s/%s", team, repoOwner, repoName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check the permissions of @%s: %v", team, err)
+	}
+	permissions := repo.GetPermissions()
+	if permissions["admin"] || permissions["maintain"] || permissions["push"] {
+		return nil
+	}
+	return fmt.Errorf("team @%s does not have write access to %s/%s", team, repoOwner, repoName)
+}
+
+// checkRulesetOwners checks the owners of every rule, returning an error naming each invalid rule and owner.
+func (c *providerConfiguration) checkRulesetOwners(ctx context.Context, repoOwner, repoName string, rules Ruleset, sections []Section) error {
+	var problems []string
+	check := func(location string, owners []string) {
+		for _, owner := range owners {
+			if err := c.checkOwner(ctx, repoOwner, repoName, owner); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", location, err))
+			}
+		}
+	}
+	for _, rule := range rules {
+		check(fmt.Sprintf("rule %q", rule.Pattern), rule.Usernames)
+	}
+	for _, section := range sections {
+		check(fmt.Sprintf("section %q", section.Name), section.DefaultOwners)
+		for _, rule := range section.Rules {
+			check(fmt.Sprintf("rule %q in section %q", rule.Pattern, section.Name), rule.Usernames)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid owners:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// validateOwnersDiff validates the owners of the rules at plan time when validate_owners is set.
+func validateOwnersDiff(d *schema.ResourceDiff, m interface{}) error {
+	if !d.Get("validate_owners").(bool) {
+		return nil
+	}
+	if !d.NewValueKnown("repository_owner") || !d.NewValueKnown("repository_name") || !d.NewValueKnown("rules") || !d.NewValueKnown("section") {
+		return nil
+	}
+	if d.Get("dialect").(string) == dialectGitLab {
+		log.Printf("[WARN] validate_owners is ignored for the %q dialect, as owners cannot be resolved through GitHub", dialectGitLab)
+		return nil
+	}
+
+	config := m.(*providerConfiguration)
+	return config.checkRulesetOwners(
+		context.Background(),
+		d.Get("repository_owner").(string),
+		d.Get("repository_name").(string),
+		expandRuleset(d.Get("rules").([]interface{})),
+		expandSections(d.Get("section").([]interface{})),
+	)
+}
@@ -0,0 +1,45 @@
+package codeowners
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckRulesetOwners(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/r/collaborators/writer/permission", http.StatusOK, `{"permission": "write"}`)
+	f.handle("/repos/o/r/collaborators/reader/permission", http.StatusOK, `{"permission": "read"}`)
+	f.handle("/repos/o/r/collaborators/typo/permission", http.StatusNotFound, `{"message": "Not Found"}`)
+	f.handle("/orgs/o/teams/maintainers/repos/o/r", http.StatusOK, `{"permissions": {"pull": true, "push": true}}`)
+	f.handle("/orgs/o/teams/viewers/repos/o/r", http.StatusOK, `{"permissions": {"pull": true}}`)
+	f.handle("/orgs/o/teams/hidden/repos/o/r", http.StatusNotFound, `{"message": "Not Found"}`)
+
+	config := f.config(t)
+	err := config.checkRulesetOwners(context.Background(), "o", "r", Ruleset{
+		{Pattern: "*", Usernames: []string{"writer", "o/maintainers", "someone@example.com"}},
+		{Pattern: "*.go", Usernames: []string{"writer", "reader", "typo"}},
+	}, []Section{
+		{Name: "Docs", DefaultOwners: []string{"o/viewers"}, Rules: Ruleset{{Pattern: "docs/", Usernames: []string{"o/hidden"}}}},
+	})
+	require.Error(t, err)
+	assert.Equal(t, `invalid owners:
+  rule "*.go": user @reader does not have write access to o/r
+  rule "*.go": user @typo does not exist
+  section "Docs": team @o/viewers does not have write access to o/r
+  rule "docs/" in section "Docs": team @o/hidden does not exist, is not visible or has no access to o/r`, err.Error())
+
+	// writer is checked once, however many rules it appears in.
+	checks := 0
+	for _, r := range f.requests {
+		if r == "GET /repos/o/r/collaborators/writer/permission" {
+			checks++
+		}
+	}
+	assert.Equal(t, 1, checks)
+
+	assert.NoError(t, config.checkRulesetOwners(context.Background(), "o", "r", Ruleset{{Pattern: "*", Usernames: []string{"writer"}}}, nil))
+}
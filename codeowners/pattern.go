@@ -0,0 +1,167 @@
+package codeowners
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// checkPattern checks that the pattern uses only the gitignore syntax GitHub supports in CODEOWNERS files. Patterns are
+// given unescaped: whitespace is escaped with a backslash when compiling.
+func checkPattern(pattern string) error {
+	switch {
+	case pattern == "":
+		return errors.New("pattern must not be empty")
+	case strings.HasPrefix(pattern, "!"):
+		return errors.New("negating a pattern with ! is not supported")
+	case strings.HasPrefix(pattern, "#"):
+		return errors.New("a pattern starting with # would be read as a comment")
+	case strings.HasPrefix(pattern, `\#`):
+		return errors.New(`escaping a pattern starting with # using \ is not supported`)
+	case strings.ContainsAny(pattern, "[]"):
+		return errors.New("character ranges using [ ] are not supported")
+	case strings.ContainsAny(pattern, "\r\n"):
+		return errors.New("pattern must not contain line breaks")
+	}
+	return checkEscapes(pattern)
+}
+
+// checkEscapes checks that every backslash of the pattern escapes a character other than whitespace, which is escaped
+// automatically.
+func checkEscapes(pattern string) error {
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped && unicode.IsSpace(r):
+			return errors.New(`whitespace is escaped automatically, so must not be escaped with \`)
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		}
+	}
+	if escaped {
+		return errors.New("a backslash must be followed by the character it escapes")
+	}
+	return nil
+}
+
+// escapePattern escapes the whitespace of the pattern for a CODEOWNERS line, so that it isn't read as the end of the
+// pattern.
+func escapePattern(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); {
+		r, size := utf8.DecodeRuneInString(pattern[i:])
+		if unicode.IsSpace(r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteString(pattern[i : i+size])
+		i += size
+	}
+	return sb.String()
+}
+
+// unescapePattern reverses escapePattern, leaving the other escapes of the pattern as they are.
+func unescapePattern(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '\\' || i+1 == len(pattern) {
+			sb.WriteByte(pattern[i])
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(pattern[i+1:])
+		if !unicode.IsSpace(r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteString(pattern[i+1 : i+1+size])
+		i += size
+	}
+	return sb.String()
+}
+
+// validatePattern is a schema.SchemaValidateFunc checking that a pattern is supported in CODEOWNERS files.
+func validatePattern(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if err := checkPattern(v); err != nil {
+		return nil, []error{fmt.Errorf("%s: invalid pattern %q: %s", k, v, err)}
+	}
+	return nil, nil
+}
+
+// patternMatcher matches paths against a CODEOWNERS pattern, following the gitignore rules GitHub supports.
+type patternMatcher struct {
+	re *regexp.Regexp
+	// dirOnly is set for patterns ending with "/", which only match directories and so the files within them.
+	dirOnly bool
+	// contents is set for patterns ending with "/*", which only match the files directly within a directory.
+	contents bool
+}
+
+func newPatternMatcher(pattern string) (*patternMatcher, error) {
+	m := &patternMatcher{
+		dirOnly:  strings.HasSuffix(pattern, "/"),
+		contents: strings.HasSuffix(pattern, "/*"),
+	}
+	p := strings.TrimSuffix(pattern, "/")
+	// Patterns with a slash other than a trailing one are relative to the root, others match at any depth.
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '\\' && i+1 < len(p):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(p[i])))
+		case strings.HasPrefix(p[i:], "**/") && (i == 0 || p[i-1] == '/'):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**") && i+2 == len(p) && (i == 0 || p[i-1] == '/'):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile pattern %q: %v", pattern, err)
+	}
+	m.re = re
+	return m, nil
+}
+
+// match returns whether the pattern matches the file at the given path, relative to the root of the repository.
+// Patterns matching a directory match every file within it.
+func (m *patternMatcher) match(path string) bool {
+	path = strings.TrimPrefix(path, "/")
+	if !m.dirOnly && m.re.MatchString(path) {
+		return true
+	}
+	if m.contents {
+		return false
+	}
+	for i := len(path) - 1; i > 0; i-- {
+		if path[i] == '/' && m.re.MatchString(path[:i]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPattern(t *testing.T) {
+	valid := []string{"*", "*.go", "/build/logs/", "docs/*", "**/logs", "apps/**/*.ts", `foo\bar`, "docs/My Folder/", "foo\tbar"}
+	for _, pattern := range valid {
+		assert.NoError(t, checkPattern(pattern), pattern)
+	}
+
+	invalid := []string{"", "!foo", "#foo", `\#foo`, "[a-z].go", "foo]", "foo\nbar", `foo\ bar`, `foo\`}
+	for _, pattern := range invalid {
+		assert.Error(t, checkPattern(pattern), pattern)
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	_, errs := validatePattern("*.go", "rules.0.pattern")
+	assert.Empty(t, errs)
+
+	_, errs = validatePattern("[a-z].go", "rules.0.pattern")
+	assert.Len(t, errs, 1)
+}
+
+func TestEscapePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		escaped string
+	}{
+		{pattern: "*.go", escaped: "*.go"},
+		{pattern: "docs/My Folder/", escaped: `docs/My\ Folder/`},
+		{pattern: "a\tb  c", escaped: "a\\\tb\\ \\ c"},
+		{pattern: "docs/#notes", escaped: "docs/#notes"},
+		{pattern: `foo\*`, escaped: `foo\*`},
+		{pattern: `foo\\ bar`, escaped: `foo\\\ bar`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			assert.Equal(t, test.escaped, escapePattern(test.pattern))
+			assert.Equal(t, test.pattern, unescapePattern(test.escaped))
+		})
+	}
+}
+
+func TestPatternMatcher(t *testing.T) {
+	tests := []struct {
+		pattern string
+		matches []string
+		misses  []string
+	}{
+		{pattern: "*", matches: []string{"README.md", "src/main.go"}},
+		{pattern: "*.js", matches: []string{"app.js", "src/app.js"}, misses: []string{"app.jsx", "app.ts"}},
+		{pattern: "/build/logs/", matches: []string{"build/logs/a.log", "build/logs/deep/b.log"}, misses: []string{"src/build/logs/a.log", "build/logs"}},
+		{pattern: "docs/*", matches: []string{"docs/getting-started.md"}, misses: []string{"docs/build-app/troubleshooting.md", "src/docs/a.md"}},
+		{pattern: "apps/", matches: []string{"apps/a.go", "src/apps/b/c.go"}, misses: []string{"apps"}},
+		{pattern: "/docs/", matches: []string{"docs/a.md", "docs/b/c.md"}, misses: []string{"src/docs/a.md"}},
+		{pattern: "/scripts/", matches: []string{"scripts/run.sh"}, misses: []string{"tools/scripts/run.sh"}},
+		{pattern: "**/logs", matches: []string{"logs/a", "build/logs/a", "deeply/nested/logs/a"}, misses: []string{"logsfoo/a"}},
+		{pattern: "docs/**", matches: []string{"docs/a.md", "docs/b/c.md"}, misses: []string{"docs", "src/docs/a.md"}},
+		{pattern: "a/**/b", matches: []string{"a/b", "a/x/b", "a/x/y/b/c"}, misses: []string{"a/xb"}},
+		{pattern: "file?.txt", matches: []string{"file1.txt", "dir/fileA.txt"}, misses: []string{"file10.txt", "file/.txt"}},
+		{pattern: "LICENSE", matches: []string{"LICENSE", "vendor/x/LICENSE"}, misses: []string{"LICENSE.md"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			m, err := newPatternMatcher(test.pattern)
+			require.NoError(t, err)
+			for _, path := range test.matches {
+				assert.True(t, m.match(path), "%s should match %s", test.pattern, path)
+			}
+			for _, path := range test.misses {
+				assert.False(t, m.match(path), "%s should not match %s", test.pattern, path)
+			}
+		})
+	}
+}
@@ -1,17 +1,42 @@
 package codeowners
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/v54/github"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
-	tpg "github.com/integrations/terraform-provider-github/v5/github"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/validation"
+	"golang.org/x/oauth2"
 )
 
 // Provider exposes the provider to terraform
 func Provider() *schema.Provider {
 	return &schema.Provider{
 		Schema: map[string]*schema.Schema{
+			"base_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The GitHub API base URL - set this to the root of your GitHub Enterprise Server instance (e.g. https://github.example.com/) to manage repositories hosted there",
+				DefaultFunc: schema.EnvDefaultFunc("GITHUB_BASE_URL", defaultBaseURL),
+			},
+			"upload_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The GitHub uploads API URL - defaults to the uploads endpoint matching base_url",
+				DefaultFunc: schema.EnvDefaultFunc("GITHUB_UPLOAD_URL", ""),
+			},
+			"commit_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "How changes to 'CODEOWNERS' files are committed: 'push' commits straight to the branch, 'merge' opens a pull request and merges it, and 'review' opens a pull request and leaves it open for review",
+				DefaultFunc:  schema.EnvDefaultFunc("CODEOWNERS_COMMIT_MODE", commitModeMerge),
+				ValidateFunc: validation.StringInSlice(commitModes, false),
+			},
+			"pull_request": pullRequestSchema("Configures the pull requests opened in the 'merge' and 'review' commit modes"),
 			"commit_message_prefix": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -20,11 +45,46 @@ func Provider() *schema.Provider {
 			},
 			"github_token": {
 				Type:        schema.TypeString,
-				Required:    true,
-				Description: "A github token with full repo/admin access permissions to the organisation being terraformed",
+				Optional:    true,
+				Description: "A github token with full repo/admin access permissions to the organisation being terraformed - required unless app_auth is set",
 				DefaultFunc: schema.EnvDefaultFunc("GITHUB_TOKEN", nil),
 				Sensitive:   true,
 			},
+			"app_auth": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "GitHub App installation credentials to authenticate with instead of github_token",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The GitHub App ID",
+							DefaultFunc: schema.EnvDefaultFunc("GITHUB_APP_ID", nil),
+						},
+						"installation_id": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The GitHub App installation ID",
+							DefaultFunc: schema.EnvDefaultFunc("GITHUB_APP_INSTALLATION_ID", nil),
+						},
+						"pem_file": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Path to the GitHub App private key PEM file - conflicts with pem",
+							DefaultFunc: schema.EnvDefaultFunc("GITHUB_APP_PEM_FILE", ""),
+						},
+						"pem": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Contents of the GitHub App private key PEM file - conflicts with pem_file",
+							DefaultFunc: schema.EnvDefaultFunc("GITHUB_APP_PEM", ""),
+							Sensitive:   true,
+						},
+					},
+				},
+			},
 			"gpg_passphrase": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -41,53 +101,182 @@ func Provider() *schema.Provider {
 			},
 			"email": {
 				Type:        schema.TypeString,
-				Required:    true,
-				Description: "Email to use for commit messages - if a GPG key is provided, this email must match that used in the key",
+				Optional:    true,
+				Description: "Email to use for commit messages - if a GPG key is provided, this email must match that used in the key. Defaults to the App's bot user email when using app_auth",
 				DefaultFunc: schema.EnvDefaultFunc("GITHUB_EMAIL", nil),
 				Sensitive:   true,
 			},
 			"username": {
 				Type:        schema.TypeString,
-				Required:    true,
-				Description: "Username to use for commit messages",
+				Optional:    true,
+				Description: "Username to use for commit messages - defaults to the App's bot user when using app_auth",
 				DefaultFunc: schema.EnvDefaultFunc("GITHUB_USERNAME", nil),
 				Sensitive:   true,
 			},
 		},
+		DataSourcesMap: map[string]*schema.Resource{
+			"codeowners_coverage": dataSourceCoverage(),
+			"codeowners_errors":   dataSourceErrors(),
+			"codeowners_owners":   dataSourceOwners(),
+		},
 		ResourcesMap: map[string]*schema.Resource{
-			"codeowners_file": resourceFile(),
+			"codeowners_file":  resourceFile(),
+			"codeowners_files": resourceFiles(),
+			"codeowners_rule":  resourceRule(),
 		},
 		ConfigureFunc: providerConfigure,
 	}
 }
 
+const (
+	defaultBaseURL       = "https://api.github.com/"
+	enterpriseAPIPath    = "api/v3/"
+	enterpriseUploadPath = "api/uploads/"
+)
+
 type providerConfiguration struct {
 	commitMessagePrefix string
+	commitMode          string
+	pullRequest         *pullRequestOptions
 	client              *github.Client
+	parallelClient      *github.Client
 	ghUsername          string
 	ghEmail             string
 	gpgKey              string
 	gpgPassphrase       string
+	maxRetries          int
+	retryBackoff        time.Duration
+	ruleBatcher         *ruleBatcher
+	ownerChecks         *ownerCheckCache
+}
+
+// parallel returns a copy of the configuration whose client makes read requests concurrently rather than one at a
+// time, for resources which bound their own concurrency. Write requests are still made one at a time.
+func (c *providerConfiguration) parallel() *providerConfiguration {
+	if c.parallelClient == nil {
+		return c
+	}
+	p := *c
+	p.client = c.parallelClient
+	return &p
 }
 
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 
-	c := tpg.Config{
-		Token:   d.Get("github_token").(string),
-		BaseURL: "https://api.github.com/",
+	baseURL, err := normaliseBaseURL(d.Get("base_url").(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base_url: %v", err)
+	}
+
+	factory := &clientFactory{
+		baseURL:   baseURL,
+		uploadURL: d.Get("upload_url").(string),
 	}
 
-	gc, err := c.NewRESTClient(c.AuthenticatedHTTPClient())
+	app, err := expandAppAuth(d.Get("app_auth").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	var ts oauth2.TokenSource
+	if app != nil {
+		ts = app.tokenSource(ctx, factory)
+	} else {
+		token := d.Get("github_token").(string)
+		if token == "" {
+			return nil, fmt.Errorf("one of github_token or app_auth must be set")
+		}
+		ts = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	}
+
+	// Both clients share the token, rather than each minting their own.
+	ts = oauth2.ReuseTokenSource(nil, ts)
+	gc, err := factory.newClient(oauth2.NewClient(ctx, ts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub Client: %v", err)
+	}
+	pc, err := factory.newParallelReadsClient(oauth2.NewClient(ctx, ts), gc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GitHub Client: %v", err)
 	}
 
-	return &providerConfiguration{
+	username := d.Get("username").(string)
+	email := d.Get("email").(string)
+	if username == "" || email == "" {
+		if app == nil {
+			return nil, fmt.Errorf("username and email must be set when authenticating with github_token")
+		}
+		// Attribute commits to the App's bot user unless told otherwise.
+		botUsername, botEmail, err := app.botIdentity(ctx, factory, gc)
+		if err != nil {
+			return nil, err
+		}
+		if username == "" {
+			username = botUsername
+		}
+		if email == "" {
+			email = botEmail
+		}
+	}
+
+	config := &providerConfiguration{
 		commitMessagePrefix: d.Get("commit_message_prefix").(string),
+		commitMode:          d.Get("commit_mode").(string),
+		pullRequest:         expandPullRequestOptions(d.Get("pull_request").([]interface{})),
 		client:              gc,
-		ghEmail:             d.Get("email").(string),
-		ghUsername:          d.Get("username").(string),
+		parallelClient:      pc,
+		ghEmail:             email,
+		ghUsername:          username,
 		gpgKey:              d.Get("gpg_secret_key").(string),
 		gpgPassphrase:       d.Get("gpg_passphrase").(string),
-	}, nil
+		maxRetries:          3,
+		retryBackoff:        5 * time.Second,
+		ownerChecks:         newOwnerCheckCache(),
+	}
+	config.ruleBatcher = newRuleBatcher(config, ruleBatchDelay)
+
+	return config, nil
+}
+
+// normaliseBaseURL returns the root URL of the GitHub instance in the form expected by tpg.Config, which appends
+// the "/api/v3/" suffix itself for anything other than github.com. Users are free to provide the URL with or without
+// a trailing slash and with or without the "/api/v3/" suffix.
+func normaliseBaseURL(raw string) (string, error) {
+	if raw == "" {
+		return defaultBaseURL, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q must be an absolute URL", raw)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.Path = strings.TrimSuffix(u.Path, enterpriseAPIPath)
+	return u.String(), nil
+}
+
+// configureUploadURL points the client's upload endpoint at the same GitHub instance as its API endpoint, unless an
+// explicit upload URL has been provided.
+func configureUploadURL(client *github.Client, baseURL, uploadURL string) error {
+	if uploadURL == "" {
+		if baseURL == defaultBaseURL {
+			return nil
+		}
+		uploadURL = baseURL + enterpriseUploadPath
+	}
+	u, err := url.Parse(uploadURL)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	client.UploadURL = u
+	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/google/go-github/v54/github"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/terraform"
 )
@@ -38,3 +39,53 @@ func init() {
 		"codeowners": testAccProvider,
 	}
 }
+
+func TestNormaliseBaseURL(t *testing.T) {
+	tests := map[string]string{
+		"":                                   "https://api.github.com/",
+		"https://api.github.com":             "https://api.github.com/",
+		"https://api.github.com/":            "https://api.github.com/",
+		"https://github.example.com":         "https://github.example.com/",
+		"https://github.example.com/":        "https://github.example.com/",
+		"https://github.example.com/api/v3":  "https://github.example.com/",
+		"https://github.example.com/api/v3/": "https://github.example.com/",
+		"https://example.com/github/api/v3/": "https://example.com/github/",
+		"https://example.com/github":         "https://example.com/github/",
+	}
+
+	for in, expected := range tests {
+		actual, err := normaliseBaseURL(in)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", in, err)
+		}
+		if actual != expected {
+			t.Errorf("expected %q to be normalised to %q, got %q", in, expected, actual)
+		}
+	}
+
+	if _, err := normaliseBaseURL("github.example.com"); err == nil {
+		t.Errorf("expected an error for a relative URL")
+	}
+}
+
+func TestConfigureUploadURL(t *testing.T) {
+	tests := []struct {
+		baseURL   string
+		uploadURL string
+		expected  string
+	}{
+		{baseURL: "https://api.github.com/", expected: "https://uploads.github.com/"},
+		{baseURL: "https://github.example.com/", expected: "https://github.example.com/api/uploads/"},
+		{baseURL: "https://github.example.com/", uploadURL: "https://uploads.example.com", expected: "https://uploads.example.com/"},
+	}
+
+	for _, test := range tests {
+		client := github.NewClient(nil)
+		if err := configureUploadURL(client, test.baseURL, test.uploadURL); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if client.UploadURL.String() != test.expected {
+			t.Errorf("expected upload URL %q, got %q", test.expected, client.UploadURL.String())
+		}
+	}
+}
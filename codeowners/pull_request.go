@@ -0,0 +1,128 @@
+package codeowners
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/validation"
+)
+
+var mergeMethods = []string{"merge", "squash", "rebase"}
+
+type pullRequestOptions struct {
+	MergeMethod   string
+	Labels        []string
+	Reviewers     []string
+	TeamReviewers []string
+	BodyTemplate  string
+}
+
+// pullRequestBodyData is made available to the pull request body template.
+type pullRequestBodyData struct {
+	RepositoryOwner string
+	RepositoryName  string
+	Branch          string
+	Before          Ruleset
+	After           Ruleset
+	Diff            string
+}
+
+func pullRequestSchema(description string) *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Description: description,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"merge_method": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "merge",
+					Description:  "The method used to merge pull requests: 'merge', 'squash' or 'rebase'",
+					ValidateFunc: validation.StringInSlice(mergeMethods, false),
+				},
+				"labels": {
+					Type:        schema.TypeSet,
+					Optional:    true,
+					Description: "Labels to add to pull requests",
+					Elem:        &schema.Schema{Type: schema.TypeString},
+					Set:         schema.HashString,
+				},
+				"reviewers": {
+					Type:        schema.TypeSet,
+					Optional:    true,
+					Description: "Usernames of users to request reviews from",
+					Elem:        &schema.Schema{Type: schema.TypeString},
+					Set:         schema.HashString,
+				},
+				"team_reviewers": {
+					Type:        schema.TypeSet,
+					Optional:    true,
+					Description: "Slugs of teams to request reviews from",
+					Elem:        &schema.Schema{Type: schema.TypeString},
+					Set:         schema.HashString,
+				},
+				"body_template": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Description:  "A Go template rendered as the pull request body - .RepositoryOwner, .RepositoryName, .Branch, the .Before and .After rules and a rendered .Diff of the two are available",
+					ValidateFunc: validatePullRequestBodyTemplate,
+				},
+			},
+		},
+	}
+}
+
+func validatePullRequestBodyTemplate(v interface{}, k string) ([]string, []error) {
+	if _, err := template.New(k).Parse(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%s is not a valid template: %v", k, err)}
+	}
+	return nil, nil
+}
+
+// expandPullRequestOptions reads a 'pull_request' block, returning nil if it has not been set.
+func expandPullRequestOptions(in []interface{}) *pullRequestOptions {
+	if len(in) == 0 || in[0] == nil {
+		return nil
+	}
+	attrs := in[0].(map[string]interface{})
+	return &pullRequestOptions{
+		MergeMethod:   attrs["merge_method"].(string),
+		Labels:        expandStringSet(attrs["labels"]),
+		Reviewers:     expandStringSet(attrs["reviewers"]),
+		TeamReviewers: expandStringSet(attrs["team_reviewers"]),
+		BodyTemplate:  attrs["body_template"].(string),
+	}
+}
+
+func expandStringSet(in interface{}) []string {
+	set, ok := in.(*schema.Set)
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, v := range set.List() {
+		out = append(out, v.(string))
+	}
+	return out
+}
+
+// renderBody renders the body template, if any, with the rules before and after the change.
+func (o *pullRequestOptions) renderBody(data *pullRequestBodyData) (string, error) {
+	if o == nil || o.BodyTemplate == "" {
+		return "", nil
+	}
+	t, err := template.New("body_template").Parse(o.BodyTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse pull request body template: %v", err)
+	}
+	data.Diff = diffRulesets(data.Before, data.After)
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render pull request body template: %v", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,40 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderPullRequestBody(t *testing.T) {
+	o := &pullRequestOptions{
+		BodyTemplate: "Updating CODEOWNERS on {{ .RepositoryOwner }}/{{ .RepositoryName }}:{{ .Branch }} " +
+			"({{ len .Before }} -> {{ len .After }} rules)\n```diff\n{{ .Diff }}```",
+	}
+
+	body, err := o.renderBody(&pullRequestBodyData{
+		RepositoryOwner: "my-org",
+		RepositoryName:  "my-repo",
+		Branch:          "main",
+		Before:          Ruleset{{Pattern: "*", Usernames: []string{"expert"}}},
+		After:           Ruleset{{Pattern: "*", Usernames: []string{"expert"}}, {Pattern: "*.go", Usernames: []string{"go-expert"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Updating CODEOWNERS on my-org/my-repo:main (1 -> 2 rules)\n```diff\n  * @expert\n+ *.go @go-expert\n```", body)
+}
+
+func TestRenderPullRequestBodyWithoutTemplate(t *testing.T) {
+	var o *pullRequestOptions
+	body, err := o.renderBody(&pullRequestBodyData{})
+	require.NoError(t, err)
+	assert.Empty(t, body)
+}
+
+func TestValidatePullRequestBodyTemplate(t *testing.T) {
+	_, errs := validatePullRequestBodyTemplate("{{ .Diff }}", "body_template")
+	assert.Empty(t, errs)
+
+	_, errs = validatePullRequestBodyTemplate("{{ .Diff ", "body_template")
+	assert.Len(t, errs, 1)
+}
@@ -1,24 +1,53 @@
 package codeowners
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"reflect"
 	"sort"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/google/go-github/v54/github"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/validation"
 
 	"github.com/form3tech-oss/go-github-utils/pkg/branch"
-	githubcommitutils "github.com/form3tech-oss/go-github-utils/pkg/commit"
 	githubfileutils "github.com/form3tech-oss/go-github-utils/pkg/file"
 )
 
-const codeownersPath = ".github/CODEOWNERS"
+const defaultCodeownersPath = ".github/CODEOWNERS"
+
+const (
+	conflictFail      = "fail"
+	conflictOverwrite = "overwrite"
+)
+
+var conflictBehaviours = []string{conflictFail, conflictOverwrite}
+
+const (
+	existingFail      = "fail"
+	existingOverwrite = "overwrite"
+	existingMerge     = "merge"
+)
+
+var existingBehaviours = []string{existingFail, existingOverwrite, existingMerge}
+
+const (
+	deleteRemoveFile = "remove_file"
+	deleteEmptyFile  = "empty_file"
+	deleteAbandon    = "abandon"
+)
+
+var deleteBehaviors = []string{deleteRemoveFile, deleteEmptyFile, deleteAbandon}
+
+// codeownersPaths lists the locations GitHub looks for a CODEOWNERS file in, in order of precedence. Only the first
+// file found is used.
+var codeownersPaths = []string{defaultCodeownersPath, "CODEOWNERS", "docs/CODEOWNERS"}
 
 func resourceFile() *schema.Resource {
 	return &schema.Resource{
@@ -29,6 +58,7 @@ func resourceFile() *schema.Resource {
 		Importer: &schema.ResourceImporter{
 			State: resourceFileImport,
 		},
+		CustomizeDiff: resourceFileCustomizeDiff,
 		Schema: map[string]*schema.Schema{
 			"repository_owner": {
 				Type:        schema.TypeString,
@@ -49,29 +79,181 @@ func resourceFile() *schema.Resource {
 				Default:     "",
 				ForceNew:    true,
 			},
+			"path": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "The location of the CODEOWNERS file: '.github/CODEOWNERS', 'CODEOWNERS' or 'docs/CODEOWNERS'",
+				Default:      defaultCodeownersPath,
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice(codeownersPaths, false),
+			},
+			"fail_if_shadowed": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Whether to fail rather than warn when a CODEOWNERS file in a location of higher precedence shadows the managed one",
+				Default:     false,
+			},
+			"validate_owners": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Whether to check at plan time that every user and team exists and has write access to the repository",
+				Default:     false,
+			},
+			"fail_on_errors": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Whether to fail when GitHub reports errors for the file once the change has landed",
+				Default:     false,
+			},
+			"revert_on_errors": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Whether to revert the change when fail_on_errors fails",
+				Default:     false,
+			},
+			"lint_level": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "How to report rules which are unreachable, duplicated or have no owners when planning: 'off', 'warn' or 'error'",
+				Default:      lintLevelWarn,
+				ValidateFunc: validation.StringInSlice(lintLevels, false),
+			},
+			"minimum_coverage": {
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				Description:  "The minimum percentage of the files of the branch the rules must give owners to, checked when planning",
+				Default:      0,
+				ValidateFunc: validation.FloatBetween(0, 100),
+			},
+			"on_conflict": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "What to do when the file has been changed by someone else since it was last read: 'fail' or 'overwrite'",
+				Default:      conflictFail,
+				ValidateFunc: validation.StringInSlice(conflictBehaviours, false),
+			},
+			"delete_behavior": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "What to do with the file when the resource is destroyed: 'remove_file', leave an 'empty_file', or 'abandon' it as it is",
+				Default:      deleteRemoveFile,
+				ValidateFunc: validation.StringInSlice(deleteBehaviors, false),
+			},
+			"on_existing": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "What to do when creating the resource if the file already has rules: 'fail', 'overwrite' them or 'merge' with them, keeping the rules for patterns which aren't configured",
+				Default:      existingFail,
+				ValidateFunc: validation.StringInSlice(existingBehaviours, false),
+			},
+			"preserved_patterns": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The patterns of the rules kept from the existing file when merging with it, which aren't managed",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"blob_sha": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The SHA of the blob of the file when it was last read",
+			},
+			"head_sha": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The SHA of the head commit of the branch when the file was last read",
+			},
+			"managed_section": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "When set, only the rules between the '# BEGIN <managed_section>' and '# END <managed_section>' lines are managed and the rest of the file is preserved",
+				Default:     "",
+			},
+			"commit_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Overrides the provider's commit_mode for this file: 'push', 'merge' or 'review'",
+				ValidateFunc: validation.StringInSlice(commitModes, false),
+			},
+			"pull_request": pullRequestSchema("Overrides the provider's pull_request settings for this file"),
+			"pull_request_number": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The number of the pull request awaiting review when using the 'review' commit mode",
+			},
+			"pull_request_url": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The URL of the pull request which made the last change in the 'merge' commit mode, or which awaits review in the 'review' commit mode",
+			},
+			"content": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The content of the file as written",
+			},
+			"commit_sha": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The SHA of the last commit which changed the file, or of the commit awaiting review in the 'review' commit mode",
+			},
+			"dialect": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "The CODEOWNERS syntax to use: 'github' or 'gitlab' - only the latter supports sections",
+				Default:      dialectGitHub,
+				ValidateFunc: validation.StringInSlice(dialects, false),
+			},
+			"format": formatSchema(),
 			"rules": {
 				Type:        schema.TypeList,
 				ConfigMode:  schema.SchemaConfigModeAttr,
 				Optional:    true,
 				Description: "A list of rules that describe which reviewers should be assigned to which areas of the source code",
+				Elem:        ruleResource(true),
+			},
+			"section": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "GitLab sections, rendered after the rules - requires the 'gitlab' dialect",
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
-						"pattern": {
+						"name": {
 							Type:        schema.TypeString,
 							Required:    true,
-							Description: "A pattern which follows the same rules used in gitignore files",
+							Description: "The name of the section",
+						},
+						"optional": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Whether approval from the owners of the section is optional",
+							Default:     false,
 						},
-						"usernames": {
+						"approvals": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Description:  "The number of approvals required from the owners of the section - GitLab requires one when omitted",
+							Default:      0,
+							ValidateFunc: validation.IntAtLeast(0),
+						},
+						"default_owners": {
 							Type:        schema.TypeSet,
-							ConfigMode:  schema.SchemaConfigModeAttr,
-							Required:    true,
-							Description: "A list of usernames or team names using the standard @username or @org/team-name format - using the @ prefix is entirely optional",
+							Optional:    true,
+							Description: "The owners of the rules in the section which don't list any usernames",
 							Elem: &schema.Schema{
-								Type: schema.TypeString,
+								Type:         schema.TypeString,
+								ValidateFunc: validateOwner,
 							},
 							Set:              schema.HashString,
 							DiffSuppressFunc: usernamesDiffSupressFunc,
 						},
+						"rules": {
+							Type:        schema.TypeList,
+							ConfigMode:  schema.SchemaConfigModeAttr,
+							Optional:    true,
+							Description: "The rules of the section",
+							Elem:        ruleResource(false),
+						},
 					},
 				},
 			},
@@ -79,6 +261,159 @@ func resourceFile() *schema.Resource {
 	}
 }
 
+// formatSchema returns the schema of the 'format' block.
+func formatSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Description: "The layout of the file, which never changes the rules it is read back as",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"align_owners": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Description: "Whether to pad patterns so that the owners of the rules start in the same column",
+					Default:     false,
+				},
+				"teams_first": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Description: "Whether to sort the owners of each rule with teams before users and email addresses",
+					Default:     false,
+				},
+				"header": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Description:  "A Go template rendered as comment lines at the top of the file - .RepositoryOwner, .RepositoryName, .Branch, .Path and the .Variables are available, and an empty header renders none",
+					Default:      defaultHeader,
+					ValidateFunc: validateHeaderTemplate,
+				},
+				"footer": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Description:  "A Go template rendered as comment lines at the end of the file, with the same data as the header",
+					Default:      "",
+					ValidateFunc: validateHeaderTemplate,
+				},
+				"variables": {
+					Type:        schema.TypeMap,
+					Optional:    true,
+					Description: "Variables made available to the header and footer templates as .Variables, such as the workspace or a link to the module source",
+					Elem:        &schema.Schema{Type: schema.TypeString},
+				},
+			},
+		},
+	}
+}
+
+// ruleResource returns the schema of a rule. Usernames are optional for rules within a GitLab section, which fall
+// back to the default owners of the section.
+func ruleResource(usernamesRequired bool) *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"pattern": {
+				Type:         schema.TypeString,
+				Required:     true,
+				Description:  "A pattern which follows the same rules used in gitignore files",
+				ValidateFunc: validatePattern,
+			},
+			"usernames": {
+				Type:        schema.TypeSet,
+				ConfigMode:  schema.SchemaConfigModeAttr,
+				Required:    usernamesRequired,
+				Optional:    !usernamesRequired,
+				Description: "A list of owners using the standard @username or @org/team-name format, or email addresses - using the @ prefix for users and teams is entirely optional",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateOwner,
+				},
+				Set:              schema.HashString,
+				DiffSuppressFunc: usernamesDiffSupressFunc,
+			},
+			"comment": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "A comment rendered above the rule - multiple lines are rendered as multiple comment lines",
+				// heredocs end with a newline which doesn't survive the round trip through the file
+				DiffSuppressFunc: func(_, old, new string, _ *schema.ResourceData) bool {
+					return strings.TrimRight(old, "\n") == strings.TrimRight(new, "\n")
+				},
+			},
+			"heading": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "A heading rendered as a '## heading' line above the first of the consecutive rules sharing it",
+			},
+		},
+	}
+}
+
+// resourceFileCustomizeDiff lints the rules, validates their owners and checks their coverage at plan time, and marks
+// the attributes describing the last commit as unknown when the file will change.
+func resourceFileCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	if err := lintDiff(d); err != nil {
+		return err
+	}
+	if err := validateOwnersDiff(d, m); err != nil {
+		return err
+	}
+	if err := minimumCoverageDiff(d, m); err != nil {
+		return err
+	}
+	return commitDiff(d)
+}
+
+// commitDiff marks the attributes describing the last commit as unknown when the rules, sections, format, managed
+// section or dialect change, as applying commits a new version of the file.
+func commitDiff(d *schema.ResourceDiff) error {
+	changed := false
+	for _, key := range fileContentKeys {
+		changed = changed || !d.NewValueKnown(key)
+	}
+	if !changed && !fileChanged(d) {
+		return nil
+	}
+	for _, key := range []string{"content", "commit_sha", "blob_sha", "head_sha", "pull_request_url"} {
+		if err := d.SetNewComputed(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileContentKeys are the attributes which determine the content of the file. Changing any other attribute doesn't
+// commit anything.
+var fileContentKeys = []string{"rules", "section", "format", "managed_section", "dialect"}
+
+// changeGetter reads the changes of either a schema.ResourceData or a schema.ResourceDiff.
+type changeGetter interface {
+	GetChange(key string) (interface{}, interface{})
+}
+
+// fileChanged returns whether the rules, sections, format, managed section or dialect of the file change. They are
+// compared once expanded, as the usernames are sets, which never compare equal within a list.
+func fileChanged(d changeGetter) bool {
+	expand := func(rules, sections, format, managedSection, dialect interface{}) *File {
+		return &File{
+			Ruleset:        expandRuleset(rules.([]interface{})),
+			Sections:       expandSections(sections.([]interface{})),
+			Format:         expandFormat(format.([]interface{})),
+			ManagedSection: managedSection.(string),
+			Dialect:        dialect.(string),
+		}
+	}
+	oldRules, newRules := d.GetChange("rules")
+	oldSections, newSections := d.GetChange("section")
+	oldFormat, newFormat := d.GetChange("format")
+	oldManagedSection, newManagedSection := d.GetChange("managed_section")
+	oldDialect, newDialect := d.GetChange("dialect")
+	return !reflect.DeepEqual(
+		expand(oldRules, oldSections, oldFormat, oldManagedSection, oldDialect),
+		expand(newRules, newSections, newFormat, newManagedSection, newDialect),
+	)
+}
+
 var diffResultCache = sync.Map{}
 
 // usernamesDiffSupressFunc ignores the "@" prefix when comparing usernames.
@@ -120,12 +455,12 @@ func usernamesDiffSupressFunc(key, _, _ string, d *schema.ResourceData) bool {
 
 	oldItems := make([]string, len(oldArray))
 	for i, oldItem := range oldArray {
-		oldItems[i] = strings.TrimPrefix(fmt.Sprint(oldItem), "@")
+		oldItems[i] = normaliseOwner(fmt.Sprint(oldItem))
 	}
 
 	newItems := make([]string, len(newArray))
 	for j, newItem := range newArray {
-		newItems[j] = strings.TrimPrefix(fmt.Sprint(newItem), "@")
+		newItems[j] = normaliseOwner(fmt.Sprint(newItem))
 	}
 
 	sort.Strings(oldItems)
@@ -136,7 +471,20 @@ func usernamesDiffSupressFunc(key, _, _ string, d *schema.ResourceData) bool {
 	return result
 }
 
+// importedSettings are the settings which can't be read from the file. They are set to their defaults when importing,
+// so that an imported file doesn't plan an update.
+var importedSettings = []string{
+	"fail_if_shadowed", "validate_owners", "fail_on_errors", "revert_on_errors", "lint_level", "minimum_coverage",
+	"on_conflict", "delete_behavior", "on_existing",
+}
+
 func resourceFileImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	settings := resourceFile().Schema
+	for _, key := range importedSettings {
+		if err := d.Set(key, settings[key].Default); err != nil {
+			return nil, err
+		}
+	}
 	err := resourceFileRead(d, m)
 	return []*schema.ResourceData{d}, err
 }
@@ -148,11 +496,33 @@ func resourceFileRead(d *schema.ResourceData, m interface{}) error {
 
 	ctx := context.Background()
 
+	pending, err := refreshPendingPullRequest(ctx, config, file, d)
+	if err != nil {
+		return err
+	}
+	if pending {
+		// The changes haven't landed yet, so we keep reporting the rules which are awaiting review.
+		return flattenFile(file, d)
+	}
+
+	if file.Path == "" {
+		// We're importing, so manage whichever file GitHub uses.
+		p, err := findCodeownersFile(ctx, config, file, codeownersPaths)
+		if err != nil {
+			return err
+		}
+		if p == "" {
+			d.SetId("")
+			return nil
+		}
+		file.Path = p
+	}
+
 	getOptions := &github.RepositoryContentGetOptions{
 		Ref: file.Branch,
 	}
 
-	codeOwnerContent, _, rr, err := config.client.Repositories.GetContents(ctx, file.RepositoryOwner, file.RepositoryName, codeownersPath, getOptions)
+	codeOwnerContent, _, rr, err := config.client.Repositories.GetContents(ctx, file.RepositoryOwner, file.RepositoryName, file.Path, getOptions)
 
 	if rr != nil && rr.StatusCode == http.StatusNotFound {
 		d.SetId("")
@@ -160,15 +530,58 @@ func resourceFileRead(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err != nil || rr.StatusCode >= 500 {
-		return fmt.Errorf("failed to retrieve file %s: %v", codeownersPath, err)
+		return fmt.Errorf("failed to retrieve file %s: %v", file.Path, err)
 	}
 
 	raw, err := codeOwnerContent.GetContent()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve content for %s: %s", codeownersPath, err)
+		return fmt.Errorf("failed to retrieve content for %s: %s", file.Path, err)
+	}
+	if err := d.Set("blob_sha", codeOwnerContent.GetSHA()); err != nil {
+		return err
 	}
 
-	file.Ruleset = parseRulesFile(raw)
+	head, err := branch.GetSHAForBranch(ctx, config.client, file.RepositoryOwner, file.RepositoryName, file.Branch)
+	if err != nil {
+		return err
+	}
+	if err := d.Set("head_sha", head); err != nil {
+		return err
+	}
+	if err := d.Set("content", raw); err != nil {
+		return err
+	}
+
+	commits, _, err := config.client.Repositories.ListCommits(ctx, file.RepositoryOwner, file.RepositoryName, &github.CommitsListOptions{
+		SHA:         head,
+		Path:        file.Path,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to retrieve the last commit of %s: %v", file.Path, err)
+	}
+	if len(commits) > 0 {
+		if err := d.Set("commit_sha", commits[0].GetSHA()); err != nil {
+			return err
+		}
+	}
+
+	if err := checkShadowed(ctx, config, file, d.Get("fail_if_shadowed").(bool)); err != nil {
+		return err
+	}
+
+	rules, sections, ok := file.managedRules(raw)
+	if !ok {
+		d.SetId("")
+		return nil
+	}
+	// Rules kept from a file which existed before the resource was created aren't managed.
+	preserved, managed := splitPreservedRules(rules, d.Get("preserved_patterns").([]interface{}))
+	if err := d.Set("preserved_patterns", rulePatterns(preserved)); err != nil {
+		return err
+	}
+	file.Ruleset = managed
+	file.Sections = sections
 
 	return flattenFile(file, d)
 }
@@ -180,9 +593,13 @@ func resourceFileCreate(d *schema.ResourceData, m interface{}) error {
 func resourceFileCreateOrUpdate(s string, d *schema.ResourceData, m interface{}) error {
 	config := m.(*providerConfiguration)
 
+	ctx := context.Background()
+
 	file := expandFile(d)
+	if len(file.Sections) > 0 && file.Dialect != dialectGitLab {
+		return fmt.Errorf("sections are only supported by the %q dialect", dialectGitLab)
+	}
 	if file.Branch == "" {
-		ctx := context.Background()
 		rep, _, err := config.client.Repositories.Get(ctx, file.RepositoryOwner, file.RepositoryName)
 		if err != nil {
 			return err
@@ -190,37 +607,165 @@ func resourceFileCreateOrUpdate(s string, d *schema.ResourceData, m interface{})
 		file.Branch = *rep.DefaultBranch
 	}
 
+	if err := checkShadowed(ctx, config, file, d.Get("fail_if_shadowed").(bool)); err != nil {
+		return err
+	}
+
+	format, err := file.Format.render(file)
+	if err != nil {
+		return err
+	}
+	file.Format = format
+
+	existing, sha, existed, err := getRemoteBlob(ctx, config, file)
+	if err != nil {
+		return err
+	}
+
+	if err := checkConflict(d, file, existing, sha); err != nil {
+		return err
+	}
+
+	preserved, err := preservedRules(d, file, existing, existed)
+	if err != nil {
+		return err
+	}
+	rendered := *file
+	rendered.Ruleset = append(append(Ruleset{}, preserved...), file.Ruleset...)
+	content := rendered.render(existing)
+
 	entries := []*github.TreeEntry{
 		{
-			Path:    github.String(codeownersPath),
-			Content: github.String(string(file.Ruleset.Compile())),
+			Path:    github.String(file.Path),
+			Content: github.String(content),
 			Type:    github.String("blob"),
 			Mode:    github.String("100644"),
 		},
 	}
 
-	if err := githubcommitutils.CreateCommit(context.Background(), config.client, &githubcommitutils.CommitOptions{
-		RepoOwner:                   file.RepositoryOwner,
-		RepoName:                    file.RepositoryName,
-		CommitMessage:               formatCommitMessage(config.commitMessagePrefix, s),
-		GpgPassphrase:               config.gpgPassphrase,
-		GpgPrivateKey:               config.gpgKey,
-		Changes:                     entries,
-		Branch:                      file.Branch,
-		Username:                    config.ghUsername,
-		Email:                       config.ghEmail,
-		MaxRetries:                  3,
-		RetryBackoff:                5 * time.Second,
-		PullRequestSourceBranchName: fmt.Sprintf("terraform-provider-codeowners-%d", time.Now().UnixNano()),
-		PullRequestBody:             "",
-	}); err != nil {
+	options := &commitOptions{
+		RepoOwner:          file.RepositoryOwner,
+		RepoName:           file.RepositoryName,
+		Branch:             file.Branch,
+		CommitMessage:      formatCommitMessage(config.commitMessagePrefix, s),
+		Changes:            entries,
+		Mode:               commitMode(d, config),
+		PullRequestOptions: pullRequestSettings(d, config),
+	}
+
+	if options.Mode != commitModePush && options.PullRequestOptions != nil && options.PullRequestOptions.BodyTemplate != "" {
+		before, _, _ := file.managedRules(existing)
+		body, err := options.PullRequestOptions.renderBody(&pullRequestBodyData{
+			RepositoryOwner: file.RepositoryOwner,
+			RepositoryName:  file.RepositoryName,
+			Branch:          file.Branch,
+			Before:          before,
+			After:           rendered.Ruleset,
+		})
+		if err != nil {
+			return err
+		}
+		options.PullRequestBody = body
+	}
+
+	if options.Mode == commitModeReview {
+		pr, err := getPendingPullRequest(ctx, config, file, d)
+		if err != nil {
+			return err
+		}
+		options.PullRequest = pr
+	}
+
+	result, err := config.createCommit(ctx, options)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Set("preserved_patterns", rulePatterns(preserved)); err != nil {
+		return err
+	}
+	// These are refreshed by reading the file once the changes have landed.
+	if err := d.Set("content", content); err != nil {
+		return err
+	}
+	if err := d.Set("commit_sha", result.CommitSHA); err != nil {
+		return err
+	}
+	if err := d.Set("pull_request_url", result.PullRequest.GetHTMLURL()); err != nil {
 		return err
 	}
 
+	if options.Mode == commitModeReview {
+		if err := setPendingPullRequest(d, result.PullRequest); err != nil {
+			return err
+		}
+	}
+
+	// Changes awaiting review haven't landed yet, so there is nothing to check.
+	if d.Get("fail_on_errors").(bool) && options.Mode != commitModeReview {
+		if err := checkFileErrors(ctx, config, file); err != nil {
+			if !d.Get("revert_on_errors").(bool) {
+				if readErr := resourceFileRead(d, m); readErr != nil {
+					return readErr
+				}
+				return err
+			}
+			if revertErr := revertFile(ctx, config, options, file, existing, existed); revertErr != nil {
+				return fmt.Errorf("%v - and failed to revert: %v", err, revertErr)
+			}
+			// Keep the previous state, as the file has been reverted.
+			d.Partial(true)
+			return fmt.Errorf("%v - the change has been reverted", err)
+		}
+	}
+
 	return resourceFileRead(d, m)
 }
 
+// checkFileErrors returns an error listing the errors GitHub reports for the file, if any.
+func checkFileErrors(ctx context.Context, config *providerConfiguration, file *File) error {
+	codeownersErrors, err := getCodeownersErrors(ctx, config, file.RepositoryOwner, file.RepositoryName, file.Branch)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for _, e := range codeownersErrors {
+		// GitHub only reports errors for the file it uses, which may not be the managed one.
+		if e.Path != file.Path {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, e.Kind, e.Source))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("GitHub reports errors for %s:\n  %s", file.Path, strings.Join(problems, "\n  "))
+}
+
+// revertFile restores the previous content of the file, deleting it if it didn't exist before.
+func revertFile(ctx context.Context, config *providerConfiguration, options *commitOptions, file *File, previous string, existed bool) error {
+	entry := deletionEntry(file.Path, deleteRemoveFile)
+	if existed {
+		entry.Content = github.String(previous)
+	}
+
+	_, err := config.createCommit(ctx, &commitOptions{
+		RepoOwner:          options.RepoOwner,
+		RepoName:           options.RepoName,
+		Branch:             options.Branch,
+		CommitMessage:      formatCommitMessage(config.commitMessagePrefix, "Reverting CODEOWNERS file"),
+		Changes:            []*github.TreeEntry{entry},
+		Mode:               options.Mode,
+		PullRequestOptions: options.PullRequestOptions,
+	})
+	return err
+}
+
 func resourceFileUpdate(d *schema.ResourceData, m interface{}) error {
+	// Settings such as commit_mode or lint_level don't change the file, so there is nothing to commit.
+	if !fileChanged(d) {
+		return resourceFileRead(d, m)
+	}
 	return resourceFileCreateOrUpdate("Updating CODEOWNERS file", d, m)
 }
 
@@ -229,54 +774,290 @@ func resourceFileDelete(d *schema.ResourceData, m interface{}) error {
 
 	file := expandFile(d)
 
-	// Check whether the file exists.
-	_, err := githubfileutils.GetFile(context.Background(), config.client, file.RepositoryOwner, file.RepositoryName, file.Branch, codeownersPath)
+	// Abandon any changes which are still awaiting review.
+	pr, err := getPendingPullRequest(context.Background(), config, file, d)
 	if err != nil {
-		if err == githubfileutils.ErrNotFound {
-			return nil
+		return err
+	}
+	if pr != nil {
+		if err := config.closePullRequest(context.Background(), file.RepositoryOwner, file.RepositoryName, pr); err != nil {
+			return err
 		}
+	}
+
+	behavior := d.Get("delete_behavior").(string)
+	if behavior == deleteAbandon {
+		return nil
+	}
+
+	// Check whether the file exists.
+	existing, exists, err := getRemoteContent(context.Background(), config, file)
+	if err != nil || !exists {
 		return err
 	}
 
-	// Get the tree that corresponds to the target branch.
-	s, err := branch.GetSHAForBranch(context.Background(), config.client, file.RepositoryOwner, file.RepositoryName, file.Branch)
-	if err != nil {
+	entry := deletionEntry(file.Path, behavior)
+	message := "Deleting CODEOWNERS file"
+
+	// Keep the rules adopted from the existing file, which were never managed, without the header and footer.
+	rules, _, _ := file.managedRules(existing)
+	preserved, _ := splitPreservedRules(rules, d.Get("preserved_patterns").([]interface{}))
+	kept := (&File{Ruleset: preserved, Dialect: file.Dialect}).compile()
+
+	// Only remove the managed section, unless nothing else would be left in the file.
+	remaining := string(kept)
+	if file.ManagedSection != "" {
+		remaining = unwrapManagedSection(existing, file.ManagedSection, kept)
+		message = "Removing managed section from CODEOWNERS file"
+	} else if len(preserved) > 0 {
+		message = "Removing managed rules from CODEOWNERS file"
+	}
+	switch {
+	case strings.TrimSpace(remaining) != "":
+		entry.Content = github.String(remaining)
+	case behavior == deleteEmptyFile:
+		message = "Emptying CODEOWNERS file"
+	default:
+		message = "Deleting CODEOWNERS file"
+	}
+
+	_, err = config.createCommit(context.Background(), &commitOptions{
+		RepoOwner:          file.RepositoryOwner,
+		RepoName:           file.RepositoryName,
+		Branch:             file.Branch,
+		CommitMessage:      formatCommitMessage(config.commitMessagePrefix, message),
+		Changes:            []*github.TreeEntry{entry},
+		Mode:               commitMode(d, config),
+		PullRequestOptions: pullRequestSettings(d, config),
+	})
+	return err
+}
+
+// commitMode returns the commit mode for the resource, falling back to the provider's.
+func commitMode(d *schema.ResourceData, config *providerConfiguration) string {
+	if mode := d.Get("commit_mode").(string); mode != "" {
+		return mode
+	}
+	return config.commitMode
+}
+
+// findCodeownersFile returns the first of the given paths at which a file exists, or "" if there is none.
+func findCodeownersFile(ctx context.Context, config *providerConfiguration, file *File, paths []string) (string, error) {
+	for _, p := range paths {
+		_, err := githubfileutils.GetFile(ctx, config.client, file.RepositoryOwner, file.RepositoryName, file.Branch, p)
+		if err == nil {
+			return p, nil
+		}
+		if err != githubfileutils.ErrNotFound {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// checkShadowed warns, or fails if requested, when a CODEOWNERS file exists in a location GitHub gives precedence to
+// over the managed one, since GitHub would ignore the managed file.
+func checkShadowed(ctx context.Context, config *providerConfiguration, file *File, fail bool) error {
+	var higher []string
+	for _, p := range codeownersPaths {
+		if p == file.Path {
+			break
+		}
+		higher = append(higher, p)
+	}
+	shadowing, err := findCodeownersFile(ctx, config, file, higher)
+	if err != nil || shadowing == "" {
 		return err
 	}
-	oldTree, _, err := config.client.Git.GetTree(context.Background(), file.RepositoryOwner, file.RepositoryName, s, true)
+	msg := fmt.Sprintf("%s/%s: %s shadows the managed %s, which will be ignored by GitHub", file.RepositoryOwner, file.RepositoryName, shadowing, file.Path)
+	if fail {
+		return errors.New(msg)
+	}
+	log.Printf("[WARN] %s", msg)
+	return nil
+}
+
+// pullRequestSettings returns the pull request settings for the resource, falling back to the provider's.
+func pullRequestSettings(d *schema.ResourceData, config *providerConfiguration) *pullRequestOptions {
+	if o := expandPullRequestOptions(d.Get("pull_request").([]interface{})); o != nil {
+		return o
+	}
+	return config.pullRequest
+}
+
+// getRemoteContent returns the content of the CODEOWNERS file currently committed to the branch, and whether it
+// exists at all.
+func getRemoteContent(ctx context.Context, config *providerConfiguration, file *File) (string, bool, error) {
+	content, _, exists, err := getRemoteBlob(ctx, config, file)
+	return content, exists, err
+}
+
+// getRemoteBlob returns the content and blob SHA of the CODEOWNERS file currently committed to the branch, and
+// whether it exists at all.
+func getRemoteBlob(ctx context.Context, config *providerConfiguration, file *File) (string, string, bool, error) {
+	f, err := githubfileutils.GetFile(ctx, config.client, file.RepositoryOwner, file.RepositoryName, file.Branch, file.Path)
 	if err != nil {
-		return err
+		if err == githubfileutils.ErrNotFound {
+			return "", "", false, nil
+		}
+		return "", "", false, err
+	}
+	raw, err := f.GetContent()
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to retrieve content for %s: %s", file.Path, err)
+	}
+	return raw, f.GetSHA(), true, nil
+}
+
+// preservedRules returns the rules of the existing file which are kept alongside the managed ones. When creating the
+// resource, an existing file fails the creation unless on_existing says to overwrite it or merge with it, keeping the
+// rules for patterns which aren't configured. Afterwards, those rules are kept until a rule for their pattern is
+// configured.
+func preservedRules(d *schema.ResourceData, file *File, existing string, existed bool) (Ruleset, error) {
+	rules, sections, ok := file.managedRules(existing)
+	if !existed || !ok {
+		return nil, nil
+	}
+
+	var patterns []interface{}
+	if d.IsNewResource() {
+		if len(rules) == 0 && len(sections) == 0 {
+			return nil, nil
+		}
+		switch d.Get("on_existing").(string) {
+		case existingOverwrite:
+			return nil, nil
+		case existingMerge:
+			for _, rule := range rules {
+				patterns = append(patterns, rule.Pattern)
+			}
+		default:
+			id := fmt.Sprintf("%s/%s:%s", file.RepositoryOwner, file.RepositoryName, file.Branch)
+			return nil, fmt.Errorf("%s already exists in %s with %d rules - adopt it with 'terraform import <address> %s', or set on_existing to %q or %q",
+				file.Path, id, len(rules)+countSectionRules(sections), id, existingOverwrite, existingMerge)
+		}
+	} else {
+		patterns = d.Get("preserved_patterns").([]interface{})
+	}
+
+	preserved, _ := splitPreservedRules(rules, patterns)
+	configured := map[string]bool{}
+	for _, rule := range file.Ruleset {
+		configured[rule.Pattern] = true
+	}
+	var out Ruleset
+	for _, rule := range preserved {
+		if !configured[rule.Pattern] {
+			out = append(out, rule)
+		}
+	}
+	return out, nil
+}
+
+// splitPreservedRules splits the rules into those with the given patterns and the rest.
+func splitPreservedRules(rules Ruleset, patterns []interface{}) (Ruleset, Ruleset) {
+	keep := map[string]bool{}
+	for _, p := range patterns {
+		keep[p.(string)] = true
 	}
+	var preserved, rest Ruleset
+	for _, rule := range rules {
+		if keep[rule.Pattern] {
+			preserved = append(preserved, rule)
+		} else {
+			rest = append(rest, rule)
+		}
+	}
+	return preserved, rest
+}
+
+func rulePatterns(rules Ruleset) []string {
+	patterns := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		patterns = append(patterns, rule.Pattern)
+	}
+	return patterns
+}
 
-	// Remove the target file from the list of entries for the new tree.
-	// NOTE: Entries of type "tree" must be removed as well, otherwise deletion won't take place.
-	newTree := make([]*github.TreeEntry, 0, len(oldTree.Entries))
-	for _, entry := range oldTree.Entries {
-		if *entry.Type != "tree" && *entry.Path != codeownersPath {
-			newTree = append(newTree, entry)
+func countSectionRules(sections []Section) int {
+	n := 0
+	for _, section := range sections {
+		n += len(section.Rules)
+	}
+	return n
+}
+
+// checkConflict fails if the file has been changed by someone else since it was last read, unless told to overwrite
+// such changes. When only part of the file is managed, changes outside of the managed section are not conflicts.
+func checkConflict(d *schema.ResourceData, file *File, content, sha string) error {
+	// The recorded SHA is unknown in the plan when the file changes, so it's read from the prior state.
+	old, _ := d.GetChange("blob_sha")
+	recorded := old.(string)
+	if recorded == "" || recorded == sha || d.Get("on_conflict").(string) == conflictOverwrite {
+		return nil
+	}
+
+	if file.ManagedSection != "" {
+		oldRules, _ := d.GetChange("rules")
+		oldSections, _ := d.GetChange("section")
+		previous := &File{
+			Dialect:  file.Dialect,
+			Ruleset:  expandRuleset(oldRules.([]interface{})),
+			Sections: expandSections(oldSections.([]interface{})),
+		}
+		rules, sections, _ := file.managedRules(content)
+		current := &File{Dialect: file.Dialect, Ruleset: rules, Sections: sections}
+		if bytes.Equal(previous.compile(), current.compile()) {
+			return nil
 		}
 	}
 
-	// Create a commit based on the new tree.
-	if err := githubcommitutils.CreateCommit(context.Background(), config.client, &githubcommitutils.CommitOptions{
-		RepoOwner:                   file.RepositoryOwner,
-		RepoName:                    file.RepositoryName,
-		CommitMessage:               formatCommitMessage(config.commitMessagePrefix, "Deleting CODEOWNERS file"),
-		GpgPassphrase:               config.gpgPassphrase,
-		GpgPrivateKey:               config.gpgKey,
-		Changes:                     newTree,
-		BaseTreeOverride:            github.String(""),
-		Branch:                      file.Branch,
-		Username:                    config.ghUsername,
-		Email:                       config.ghEmail,
-		MaxRetries:                  3,
-		RetryBackoff:                5 * time.Second,
-		PullRequestSourceBranchName: fmt.Sprintf("terraform-provider-codeowners-%d", time.Now().UnixNano()),
-		PullRequestBody:             "",
-	}); err != nil {
+	return fmt.Errorf("%s on %s/%s:%s has changed since it was last read (blob %s, now %s) - refresh to review the changes, or set on_conflict = %q to overwrite them",
+		file.Path, file.RepositoryOwner, file.RepositoryName, file.Branch, recorded, sha, conflictOverwrite)
+}
+
+// getPendingPullRequest returns the pull request recorded in state if it is still open.
+func getPendingPullRequest(ctx context.Context, config *providerConfiguration, file *File, d *schema.ResourceData) (*github.PullRequest, error) {
+	number := d.Get("pull_request_number").(int)
+	if number == 0 {
+		return nil, nil
+	}
+	pr, rr, err := config.client.PullRequests.Get(ctx, file.RepositoryOwner, file.RepositoryName, number)
+	if rr != nil && rr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve PR #%d: %v", number, err)
+	}
+	if pr.GetState() != pullRequestStateOpen {
+		return nil, nil
+	}
+	return pr, nil
+}
+
+// refreshPendingPullRequest reports whether changes are still awaiting review, forgetting about the pull request
+// recorded in state once it has been merged or closed.
+func refreshPendingPullRequest(ctx context.Context, config *providerConfiguration, file *File, d *schema.ResourceData) (bool, error) {
+	pr, err := getPendingPullRequest(ctx, config, file, d)
+	if err != nil {
+		return false, err
+	}
+	if pr == nil {
+		return false, setPendingPullRequest(d, nil)
+	}
+	return true, setPendingPullRequest(d, pr)
+}
+
+// setPendingPullRequest records the pull request awaiting review. The URL of the last pull request is kept once it
+// has been merged or closed.
+func setPendingPullRequest(d *schema.ResourceData, pr *github.PullRequest) error {
+	if err := d.Set("pull_request_number", pr.GetNumber()); err != nil {
 		return err
 	}
-	return nil
+	if pr == nil {
+		return nil
+	}
+	return d.Set("pull_request_url", pr.GetHTMLURL())
 }
 
 func flattenFile(file *File, d *schema.ResourceData) error {
@@ -290,15 +1071,47 @@ func flattenFile(file *File, d *schema.ResourceData) error {
 	if err := d.Set("branch", file.Branch); err != nil {
 		return err
 	}
+	if err := d.Set("path", file.Path); err != nil {
+		return err
+	}
+	if err := d.Set("managed_section", file.ManagedSection); err != nil {
+		return err
+	}
+	dialect := file.Dialect
+	if dialect == "" {
+		dialect = dialectGitHub
+	}
+	if err := d.Set("dialect", dialect); err != nil {
+		return err
+	}
+	if err := d.Set("section", flattenSections(file.Sections)); err != nil {
+		return err
+	}
 	return d.Set("rules", flattenRuleset(file.Ruleset))
 }
 
+func flattenSections(in []Section) []interface{} {
+	var out []interface{}
+	for _, section := range in {
+		out = append(out, map[string]interface{}{
+			"name":           section.Name,
+			"optional":       section.Optional,
+			"approvals":      section.Approvals,
+			"default_owners": schema.NewSet(schema.HashString, flattenStringList(section.DefaultOwners)),
+			"rules":          flattenRuleset(section.Rules),
+		})
+	}
+	return out
+}
+
 func flattenRuleset(in Ruleset) []interface{} {
 	var out []interface{}
 	for _, rule := range in {
 		out = append(out, map[string]interface{}{
 			"pattern":   rule.Pattern,
 			"usernames": schema.NewSet(schema.HashString, flattenStringList(rule.Usernames)),
+			"comment":   rule.Comment,
+			"heading":   rule.Heading,
 		})
 	}
 	return out
@@ -319,6 +1132,8 @@ func expandFile(d *schema.ResourceData) *File {
 	file.RepositoryName = d.Get("repository_name").(string)
 	file.RepositoryOwner = d.Get("repository_owner").(string)
 	file.Branch = d.Get("branch").(string)
+	file.Path = d.Get("path").(string)
+	file.ManagedSection = d.Get("managed_section").(string)
 
 	// support imports
 	if d.Id() != "" {
@@ -335,22 +1150,65 @@ func expandFile(d *schema.ResourceData) *File {
 		}
 	}
 
+	file.Dialect = d.Get("dialect").(string)
 	file.Ruleset = expandRuleset(d.Get("rules").([]interface{}))
+	file.Sections = expandSections(d.Get("section").([]interface{}))
+	file.Format = expandFormat(d.Get("format").([]interface{}))
 	return file
 }
 
+// expandFormat reads a 'format' block, returning the default format if it has not been set.
+func expandFormat(in []interface{}) Format {
+	if len(in) == 0 || in[0] == nil {
+		return defaultFormat
+	}
+	attrs := in[0].(map[string]interface{})
+	variables := map[string]string{}
+	for k, v := range attrs["variables"].(map[string]interface{}) {
+		variables[k] = v.(string)
+	}
+	return Format{
+		AlignOwners: attrs["align_owners"].(bool),
+		TeamsFirst:  attrs["teams_first"].(bool),
+		Header:      attrs["header"].(string),
+		Footer:      attrs["footer"].(string),
+		Variables:   variables,
+	}
+}
+
+func expandSections(in []interface{}) []Section {
+	var out []Section
+	for _, section := range in {
+		section := section.(map[string]interface{})
+		out = append(out, Section{
+			Name:          section["name"].(string),
+			Optional:      section["optional"].(bool),
+			Approvals:     section["approvals"].(int),
+			DefaultOwners: expandUsernames(section["default_owners"].(*schema.Set)),
+			Rules:         expandRuleset(section["rules"].([]interface{})),
+		})
+	}
+	return out
+}
+
+func expandUsernames(in *schema.Set) []string {
+	var usernames []string
+	for _, username := range in.List() {
+		usernames = append(usernames, normaliseOwner(username.(string)))
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
 func expandRuleset(in []interface{}) Ruleset {
 	out := Ruleset{}
 	for _, rule := range in {
 		rule := rule.(map[string]interface{})
-		var usernames []string
-		for _, username := range rule["usernames"].(*schema.Set).List() {
-			usernames = append(usernames, strings.TrimPrefix(username.(string), "@"))
-		}
-		sort.Strings(usernames)
 		out = append(out, Rule{
 			Pattern:   rule["pattern"].(string),
-			Usernames: usernames,
+			Usernames: expandUsernames(rule["usernames"].(*schema.Set)),
+			Comment:   rule["comment"].(string),
+			Heading:   rule["heading"].(string),
 		})
 	}
 	return out
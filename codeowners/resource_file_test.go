@@ -2,15 +2,20 @@ package codeowners
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 
 	"github.com/google/go-github/v54/github"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const testAccFileConfig = `
@@ -81,6 +86,7 @@ func TestAccResourceFile_basic(t *testing.T) {
 					resource.TestCheckResourceAttr(resourceName, "repository_name", "enforcement-test-repo"),
 					resource.TestCheckResourceAttr(resourceName, "repository_owner", "form3tech-oss"),
 					resource.TestCheckResourceAttr(resourceName, "branch", ""),
+					resource.TestCheckResourceAttr(resourceName, "path", ".github/CODEOWNERS"),
 				),
 			},
 			{
@@ -258,11 +264,367 @@ func TestAccResourceFile_OptionalAtSign(t *testing.T) {
 	}
 }
 
+func TestCheckShadowed(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/r/contents/.github/CODEOWNERS", http.StatusOK, `{"type": "file", "path": ".github/CODEOWNERS"}`)
+	f.handle("/repos/o/r/contents/CODEOWNERS", http.StatusNotFound, `{}`)
+	config := f.config(t)
+
+	file := &File{RepositoryOwner: "o", RepositoryName: "r", Branch: "main", Path: ".github/CODEOWNERS"}
+	assert.NoError(t, checkShadowed(context.Background(), config, file, true))
+
+	file.Path = "CODEOWNERS"
+	assert.NoError(t, checkShadowed(context.Background(), config, file, false))
+	assert.EqualError(t, checkShadowed(context.Background(), config, file, true), "o/r: .github/CODEOWNERS shadows the managed CODEOWNERS, which will be ignored by GitHub")
+
+	p, err := findCodeownersFile(context.Background(), config, file, []string{"CODEOWNERS", ".github/CODEOWNERS"})
+	require.NoError(t, err)
+	assert.Equal(t, ".github/CODEOWNERS", p)
+}
+
+func TestCheckConflict(t *testing.T) {
+	r := resourceFile()
+	recorded := r.TestResourceData()
+	require.NoError(t, recorded.Set("rules", flattenRuleset(Ruleset{{Pattern: "*", Usernames: []string{"expert"}}})))
+	require.NoError(t, recorded.Set("blob_sha", "read"))
+	require.NoError(t, recorded.Set("on_conflict", conflictFail))
+	recorded.SetId("o/r:main")
+	d := r.Data(recorded.State())
+
+	file := &File{RepositoryOwner: "o", RepositoryName: "r", Branch: "main", Path: ".github/CODEOWNERS"}
+	assert.NoError(t, checkConflict(d, file, "", "read"))
+	assert.EqualError(t, checkConflict(d, file, "", "changed"),
+		`.github/CODEOWNERS on o/r:main has changed since it was last read (blob read, now changed) - refresh to review the changes, or set on_conflict = "overwrite" to overwrite them`)
+
+	// Changes outside of the managed section are not conflicts.
+	file.ManagedSection = "terraform-managed"
+	section := "# BEGIN terraform-managed\n* @expert\n# END terraform-managed\n"
+	assert.NoError(t, checkConflict(d, file, "*.js @frontend\n"+section, "changed"))
+	assert.Error(t, checkConflict(d, file, "# BEGIN terraform-managed\n* @someone-else\n# END terraform-managed\n", "changed"))
+
+	require.NoError(t, d.Set("on_conflict", conflictOverwrite))
+	file.ManagedSection = ""
+	assert.NoError(t, checkConflict(d, file, "", "changed"))
+}
+
+func TestPreservedRules(t *testing.T) {
+	existing := "* @expert\n*.go @gopher\n"
+	file := &File{
+		RepositoryOwner: "o",
+		RepositoryName:  "r",
+		Branch:          "main",
+		Path:            ".github/CODEOWNERS",
+		Ruleset:         Ruleset{{Pattern: "*.go", Usernames: []string{"my-org/gophers"}}},
+	}
+
+	d := resourceFile().TestResourceData()
+	d.MarkNewResource()
+	require.NoError(t, d.Set("on_existing", existingFail))
+
+	_, err := preservedRules(d, file, existing, true)
+	assert.EqualError(t, err, `.github/CODEOWNERS already exists in o/r:main with 2 rules - adopt it with 'terraform import <address> o/r:main', or set on_existing to "overwrite" or "merge"`)
+
+	preserved, err := preservedRules(d, file, "", false)
+	require.NoError(t, err)
+	assert.Empty(t, preserved)
+
+	require.NoError(t, d.Set("on_existing", existingOverwrite))
+	preserved, err = preservedRules(d, file, existing, true)
+	require.NoError(t, err)
+	assert.Empty(t, preserved)
+
+	// Merging keeps the rules for patterns which aren't configured.
+	require.NoError(t, d.Set("on_existing", existingMerge))
+	preserved, err = preservedRules(d, file, existing, true)
+	require.NoError(t, err)
+	assert.Equal(t, Ruleset{{Pattern: "*", Usernames: []string{"expert"}}}, preserved)
+
+	// Once created, the preserved rules are kept until their pattern is configured.
+	d = resourceFile().TestResourceData()
+	require.NoError(t, d.Set("preserved_patterns", []string{"*", "/docs/"}))
+	preserved, err = preservedRules(d, file, existing+"/docs/ @writer\n", true)
+	require.NoError(t, err)
+	assert.Equal(t, Ruleset{{Pattern: "*", Usernames: []string{"expert"}}, {Pattern: "/docs/", Usernames: []string{"writer"}}}, preserved)
+
+	file.Ruleset = append(file.Ruleset, Rule{Pattern: "*", Usernames: []string{"someone"}})
+	preserved, err = preservedRules(d, file, existing, true)
+	require.NoError(t, err)
+	assert.Empty(t, preserved)
+}
+
+func TestExpandFormat(t *testing.T) {
+	d := resourceFile().TestResourceData()
+	assert.Equal(t, defaultFormat, expandFile(d).Format)
+
+	require.NoError(t, d.Set("format", []interface{}{map[string]interface{}{
+		"align_owners": true,
+		"teams_first":  true,
+		"header":       "managed by {{ .Variables.workspace }}",
+		"footer":       "",
+		"variables":    map[string]interface{}{"workspace": "production"},
+	}}))
+	assert.Equal(t, Format{
+		AlignOwners: true,
+		TeamsFirst:  true,
+		Header:      "managed by {{ .Variables.workspace }}",
+		Variables:   map[string]string{"workspace": "production"},
+	}, expandFile(d).Format)
+}
+
+func TestResourceFileDeleteBehavior(t *testing.T) {
+	tests := []struct {
+		behavior       string
+		managedSection string
+		preserved      []interface{}
+		content        string
+		expected       map[string]interface{}
+	}{
+		{
+			behavior: deleteRemoveFile,
+			content:  "* @expert\n",
+			expected: map[string]interface{}{"path": ".github/CODEOWNERS", "type": "blob", "mode": "100644", "sha": nil},
+		},
+		{
+			behavior: deleteEmptyFile,
+			content:  "* @expert\n",
+			expected: map[string]interface{}{"path": ".github/CODEOWNERS", "type": "blob", "mode": "100644", "content": ""},
+		},
+		{
+			behavior:       deleteRemoveFile,
+			managedSection: "terraform-managed",
+			content:        "*.js @frontend\n# BEGIN terraform-managed\n* @expert\n# END terraform-managed\n",
+			expected:       map[string]interface{}{"path": ".github/CODEOWNERS", "type": "blob", "mode": "100644", "content": "*.js @frontend\n"},
+		},
+		{
+			behavior:       deleteEmptyFile,
+			managedSection: "terraform-managed",
+			content:        "# BEGIN terraform-managed\n* @expert\n# END terraform-managed\n",
+			expected:       map[string]interface{}{"path": ".github/CODEOWNERS", "type": "blob", "mode": "100644", "content": ""},
+		},
+		{
+			behavior:  deleteRemoveFile,
+			preserved: []interface{}{"*.js"},
+			content:   generatedHeader + "\n*.js @frontend\n* @expert\n",
+			expected:  map[string]interface{}{"path": ".github/CODEOWNERS", "type": "blob", "mode": "100644", "content": "*.js @frontend\n"},
+		},
+		{
+			behavior:       deleteEmptyFile,
+			managedSection: "terraform-managed",
+			preserved:      []interface{}{"*.js"},
+			content:        "/docs/ @writer\n# BEGIN terraform-managed\n*.js @frontend\n* @expert\n# END terraform-managed\n",
+			expected:       map[string]interface{}{"path": ".github/CODEOWNERS", "type": "blob", "mode": "100644", "content": "/docs/ @writer\n*.js @frontend\n"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %s %v", test.behavior, test.managedSection, test.preserved), func(t *testing.T) {
+			f := newFakeGitHub(t)
+			f.handle("/repos/o/r/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+			f.handle("/repos/o/r/commits/head", http.StatusOK, `{"sha": "head", "commit": {}}`)
+			f.handle("/repos/o/r/git/commits", http.StatusCreated, `{"sha": "new-commit"}`)
+			f.handle("/repos/o/r/git/refs/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "new-commit"}}`)
+			f.handle("/repos/o/r/contents/.github/CODEOWNERS", http.StatusOK, fmt.Sprintf(`{"type": "file", "encoding": "base64", "content": %q}`, base64.StdEncoding.EncodeToString([]byte(test.content))))
+
+			var tree map[string]interface{}
+			f.mux.HandleFunc("/repos/o/r/git/trees", func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&tree))
+				fmt.Fprint(w, `{"sha": "tree"}`)
+			})
+
+			d := resourceFile().TestResourceData()
+			d.SetId("o/r:main")
+			require.NoError(t, d.Set("repository_owner", "o"))
+			require.NoError(t, d.Set("repository_name", "r"))
+			require.NoError(t, d.Set("branch", "main"))
+			require.NoError(t, d.Set("path", ".github/CODEOWNERS"))
+			require.NoError(t, d.Set("managed_section", test.managedSection))
+			require.NoError(t, d.Set("commit_mode", commitModePush))
+			require.NoError(t, d.Set("delete_behavior", test.behavior))
+			require.NoError(t, d.Set("preserved_patterns", test.preserved))
+
+			require.NoError(t, resourceFileDelete(d, f.config(t)))
+
+			// Only the CODEOWNERS file is changed, on top of the tree of the branch.
+			assert.Equal(t, "head", tree["base_tree"])
+			assert.Equal(t, []interface{}{test.expected}, tree["tree"])
+		})
+	}
+}
+
+func TestResourceFileDeleteAbandon(t *testing.T) {
+	f := newFakeGitHub(t)
+
+	d := resourceFile().TestResourceData()
+	d.SetId("o/r:main")
+	require.NoError(t, d.Set("repository_owner", "o"))
+	require.NoError(t, d.Set("repository_name", "r"))
+	require.NoError(t, d.Set("branch", "main"))
+	require.NoError(t, d.Set("delete_behavior", deleteAbandon))
+
+	require.NoError(t, resourceFileDelete(d, f.config(t)))
+	assert.Empty(t, f.requests)
+}
+
+func TestResourceFileReadComputedAttributes(t *testing.T) {
+	content := "# automatically generated by terraform - please do not edit here\n* @expert\n"
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/r/contents/.github/CODEOWNERS", http.StatusOK, fmt.Sprintf(`{"type": "file", "encoding": "base64", "sha": "blob", "content": %q}`, base64.StdEncoding.EncodeToString([]byte(content))))
+	f.handle("/repos/o/r/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+	var query url.Values
+	f.mux.HandleFunc("/repos/o/r/commits", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, `[{"sha": "last-change"}]`)
+	})
+
+	d := resourceFile().TestResourceData()
+	d.SetId("o/r:main")
+	require.NoError(t, d.Set("path", ".github/CODEOWNERS"))
+	require.NoError(t, d.Set("pull_request_url", "https://github.com/o/r/pull/1"))
+
+	require.NoError(t, resourceFileRead(d, f.config(t)))
+
+	assert.Equal(t, content, d.Get("content"))
+	assert.Equal(t, "blob", d.Get("blob_sha"))
+	assert.Equal(t, "head", d.Get("head_sha"))
+	assert.Equal(t, "last-change", d.Get("commit_sha"))
+	assert.Equal(t, ".github/CODEOWNERS", query.Get("path"))
+	assert.Equal(t, "head", query.Get("sha"))
+	// The last pull request is kept once it has been merged.
+	assert.Equal(t, "https://github.com/o/r/pull/1", d.Get("pull_request_url"))
+	assert.Equal(t, "*", d.Get("rules.0.pattern"))
+}
+
+// testFileState returns the state of a codeowners_file with a single rule, last read at blob "blob".
+func testFileState() *terraform.InstanceState {
+	return &terraform.InstanceState{
+		ID: "o/r:main",
+		Attributes: map[string]string{
+			"id":                           "o/r:main",
+			"repository_owner":             "o",
+			"repository_name":              "r",
+			"branch":                       "main",
+			"path":                         ".github/CODEOWNERS",
+			"rules.#":                      "1",
+			"rules.0.pattern":              "*",
+			"rules.0.usernames.#":          "1",
+			"rules.0.usernames.1327207234": "expert",
+			"content":                      "* @expert\n",
+			"commit_sha":                   "last-change",
+			"blob_sha":                     "blob",
+			"head_sha":                     "head",
+			"pull_request_url":             "https://github.com/o/r/pull/1",
+			"managed_section":              "",
+			"section.#":                    "0",
+			"format.#":                     "0",
+			"preserved_patterns.#":         "0",
+			"delete_behavior":              deleteRemoveFile,
+			"dialect":                      dialectGitHub,
+			"fail_if_shadowed":             "false",
+			"fail_on_errors":               "false",
+			"revert_on_errors":             "false",
+			"validate_owners":              "false",
+			"lint_level":                   lintLevelWarn,
+			"minimum_coverage":             "0",
+			"on_conflict":                  conflictFail,
+			"on_existing":                  existingFail,
+		},
+	}
+}
+
+// testFileConfig returns the configuration of a codeowners_file with a single rule for every file.
+func testFileConfig(extra map[string]interface{}, usernames ...interface{}) *terraform.ResourceConfig {
+	raw := map[string]interface{}{
+		"repository_owner": "o",
+		"repository_name":  "r",
+		"branch":           "main",
+		"rules":            []interface{}{map[string]interface{}{"pattern": "*", "usernames": usernames}},
+	}
+	for k, v := range extra {
+		raw[k] = v
+	}
+	return terraform.NewResourceConfigRaw(raw)
+}
+
+func TestResourceFileDiffMarksCommitAttributesUnknown(t *testing.T) {
+	for name, config := range map[string]*terraform.ResourceConfig{
+		"rules":   testFileConfig(nil, "expert", "someone-else"),
+		"dialect": testFileConfig(map[string]interface{}{"dialect": dialectGitLab}, "expert"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			diff, err := resourceFile().Diff(testFileState(), config, &providerConfiguration{})
+			require.NoError(t, err)
+			for _, key := range []string{"content", "commit_sha", "blob_sha", "head_sha", "pull_request_url"} {
+				require.Contains(t, diff.Attributes, key)
+				assert.True(t, diff.Attributes[key].NewComputed, key)
+			}
+		})
+	}
+
+	diff, err := resourceFile().Diff(testFileState(), testFileConfig(nil, "expert"), &providerConfiguration{})
+	require.NoError(t, err)
+	assert.Nil(t, diff)
+}
+
+func TestResourceFileApplyDetectsConflicts(t *testing.T) {
+	f := newFakeGitHub(t)
+	// The file has been changed by someone else since it was last read at blob "blob".
+	f.handle("/repos/o/r/contents/.github/CODEOWNERS", http.StatusOK, fmt.Sprintf(`{"type": "file", "encoding": "base64", "sha": "changed", "content": %q}`, base64.StdEncoding.EncodeToString([]byte("* @someone\n"))))
+
+	diff, err := resourceFile().Diff(testFileState(), testFileConfig(nil, "expert", "someone-else"), &providerConfiguration{})
+	require.NoError(t, err)
+
+	_, err = resourceFile().Apply(testFileState(), diff, f.config(t))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has changed since it was last read (blob blob, now changed)")
+	assert.False(t, f.made("POST /repos/o/r/git/trees"))
+}
+
+func TestResourceFileUpdateWithoutFileChangesDoesNotCommit(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/r/contents/.github/CODEOWNERS", http.StatusOK, fmt.Sprintf(`{"type": "file", "encoding": "base64", "sha": "blob", "content": %q}`, base64.StdEncoding.EncodeToString([]byte("* @expert\n"))))
+	f.handle("/repos/o/r/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+	f.handle("/repos/o/r/commits", http.StatusOK, `[{"sha": "last-change"}]`)
+
+	diff, err := resourceFile().Diff(testFileState(), testFileConfig(map[string]interface{}{"lint_level": lintLevelError, "commit_mode": commitModeMerge}, "expert"), &providerConfiguration{})
+	require.NoError(t, err)
+	require.NotNil(t, diff)
+	assert.NotContains(t, diff.Attributes, "commit_sha")
+
+	state, err := resourceFile().Apply(testFileState(), diff, f.config(t))
+	require.NoError(t, err)
+	assert.Equal(t, lintLevelError, state.Attributes["lint_level"])
+	assert.Equal(t, "last-change", state.Attributes["commit_sha"])
+	assert.False(t, f.made("POST /repos/o/r/git/trees"))
+}
+
+func TestResourceFileImportSetsDefaults(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/r/contents/.github/CODEOWNERS", http.StatusOK, fmt.Sprintf(`{"type": "file", "encoding": "base64", "sha": "blob", "content": %q}`, base64.StdEncoding.EncodeToString([]byte("* @expert\n"))))
+	f.handle("/repos/o/r/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+	f.handle("/repos/o/r/commits", http.StatusOK, `[{"sha": "last-change"}]`)
+
+	d := resourceFile().TestResourceData()
+	d.SetId("o/r:main")
+	imported, err := resourceFileImport(d, f.config(t))
+	require.NoError(t, err)
+	require.Len(t, imported, 1)
+
+	state := imported[0].State()
+	// Importing the file with the default settings plans nothing.
+	diff, err := resourceFile().Diff(state, testFileConfig(nil, "expert"), &providerConfiguration{})
+	require.NoError(t, err)
+	assert.Nil(t, diff)
+	assert.Equal(t, "false", state.Attributes["fail_if_shadowed"])
+	assert.Equal(t, lintLevelWarn, state.Attributes["lint_level"])
+	assert.Equal(t, "0", state.Attributes["minimum_coverage"])
+	assert.Equal(t, existingFail, state.Attributes["on_existing"])
+}
+
 func testAccCheckFileDestroy(s *terraform.State) error {
 	config := testAccProvider.Meta().(*providerConfiguration)
 
 	for _, rs := range s.RootModule().Resources {
-		if rs.Type != "codeowners_repository_file" {
+		if rs.Type != "codeowners_file" {
 			continue
 		}
 
@@ -275,15 +637,18 @@ func testAccCheckFileDestroy(s *terraform.State) error {
 		name := sub[0]
 		branch := sub[1]
 
+		path := rs.Primary.Attributes["path"]
+
 		ctx := context.Background()
-		_, _, response, err := config.client.Repositories.GetContents(ctx, owner, name, codeownersPath, &github.RepositoryContentGetOptions{Ref: branch})
-		if err != nil || response.StatusCode >= 500 {
+		_, _, response, err := config.client.Repositories.GetContents(ctx, owner, name, path, &github.RepositoryContentGetOptions{Ref: branch})
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
 			return err
 		}
 
-		if response.StatusCode != http.StatusNotFound {
-			return fmt.Errorf("codeowners file for %q still exists", rs.Primary.ID)
-		}
+		return fmt.Errorf("codeowners file for %q still exists", rs.Primary.ID)
 	}
 
 	return nil
@@ -311,27 +676,33 @@ func testAccCheckFileExists(n string, res *File) resource.TestCheckFunc {
 		name := sub[0]
 		branch := sub[1]
 
+		path := rs.Primary.Attributes["path"]
+
 		ctx := context.Background()
-		codeOwnerContent, _, rr, err := config.client.Repositories.GetContents(ctx, owner, name, codeownersPath, &github.RepositoryContentGetOptions{Ref: branch})
+		codeOwnerContent, _, rr, err := config.client.Repositories.GetContents(ctx, owner, name, path, &github.RepositoryContentGetOptions{Ref: branch})
 		if err != nil || rr.StatusCode >= 500 {
-			return fmt.Errorf("failed to retrieve file %s: %v", codeownersPath, err)
+			return fmt.Errorf("failed to retrieve file %s: %v", path, err)
 		}
 
 		if rr.StatusCode == http.StatusNotFound {
-			return fmt.Errorf("file %s does not exist", codeownersPath)
+			return fmt.Errorf("file %s does not exist", path)
 		}
 
 		file := &File{
 			RepositoryOwner: owner,
 			RepositoryName:  name,
 			Branch:          branch,
+			Path:            path,
 		}
 
 		raw, err := codeOwnerContent.GetContent()
 		if err != nil {
 			return err
 		}
-		file.Ruleset = parseRulesFile(raw)
+		file.Ruleset, err = parseRulesFile(raw)
+		if err != nil {
+			return err
+		}
 
 		*res = *file
 		return nil
@@ -0,0 +1,655 @@
+package codeowners
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/form3tech-oss/go-github-utils/pkg/branch"
+	"github.com/google/go-github/v54/github"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/validation"
+)
+
+// defaultParallelism is how many repositories a codeowners_files resource reconciles at once, unless told otherwise.
+const defaultParallelism = 10
+
+// resultUnchanged is the result of a repository whose file already had the expected content.
+const resultUnchanged = "unchanged"
+
+func resourceFiles() *schema.Resource {
+	return &schema.Resource{
+		Create:        resourceFilesCreate,
+		Read:          resourceFilesRead,
+		Update:        resourceFilesUpdate,
+		Delete:        resourceFilesDelete,
+		CustomizeDiff: resourceFilesCustomizeDiff,
+		Schema: map[string]*schema.Schema{
+			"repositories": {
+				Type:          schema.TypeSet,
+				Optional:      true,
+				Description:   "The repositories to manage, as owner/name - conflicts with organization",
+				Elem:          &schema.Schema{Type: schema.TypeString, ValidateFunc: validateRepositoryFullName},
+				Set:           schema.HashString,
+				ConflictsWith: []string{"organization"},
+			},
+			"organization": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "An organization whose repositories to manage, narrowed down by topics and name_regex - archived repositories are skipped",
+			},
+			"topics": {
+				Type:          schema.TypeSet,
+				Optional:      true,
+				Description:   "Only manage the repositories of the organization which have all of these topics",
+				Elem:          &schema.Schema{Type: schema.TypeString},
+				Set:           schema.HashString,
+				ConflictsWith: []string{"repositories"},
+			},
+			"name_regex": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "Only manage the repositories of the organization whose names match this regular expression",
+				ValidateFunc:  validation.StringIsValidRegExp,
+				ConflictsWith: []string{"repositories"},
+			},
+			"branch": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The branch to control CODEOWNERS on - defaults to the default branch of each repository",
+				Default:     "",
+				ForceNew:    true,
+			},
+			"path": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "The location of the CODEOWNERS files: '.github/CODEOWNERS', 'CODEOWNERS' or 'docs/CODEOWNERS'",
+				Default:      defaultCodeownersPath,
+				ValidateFunc: validation.StringInSlice(codeownersPaths, false),
+				ForceNew:     true,
+			},
+			"parallelism": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "How many repositories to reconcile at once",
+				Default:      defaultParallelism,
+				ValidateFunc: validation.IntBetween(1, 100),
+			},
+			"commit_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Overrides the provider's commit_mode for these files: 'push' or 'merge' - 'review' isn't supported, as pull requests cannot be tracked per repository",
+				ValidateFunc: validation.StringInSlice(commitModes, false),
+			},
+			"pull_request": pullRequestSchema("Overrides the provider's pull_request settings for these files"),
+			"delete_behavior": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "What to do with the file of a repository which is no longer managed, or when the resource is destroyed: 'remove_file', leave an 'empty_file', or 'abandon' it as it is",
+				Default:      deleteRemoveFile,
+				ValidateFunc: validation.StringInSlice(deleteBehaviors, false),
+			},
+			"on_existing": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "What to do when a repository is selected whose file already has other rules: 'fail' or 'overwrite' them",
+				Default:      existingFail,
+				ValidateFunc: validation.StringInSlice([]string{existingFail, existingOverwrite}, false),
+			},
+			"format": formatSchema(),
+			"rules": {
+				Type:        schema.TypeList,
+				ConfigMode:  schema.SchemaConfigModeAttr,
+				Optional:    true,
+				Description: "The rules shared by every repository",
+				Elem:        ruleResource(true),
+			},
+			"override": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Rules for a single repository, written after the shared rules so that they take precedence",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"repository": {
+							Type:         schema.TypeString,
+							Required:     true,
+							Description:  "The repository the rules apply to, as owner/name",
+							ValidateFunc: validateRepositoryFullName,
+						},
+						"replace_rules": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Whether to replace the shared rules rather than add to them",
+							Default:     false,
+						},
+						"rules": {
+							Type:        schema.TypeList,
+							ConfigMode:  schema.SchemaConfigModeAttr,
+							Optional:    true,
+							Description: "The rules of the repository",
+							Elem:        ruleResource(true),
+						},
+					},
+				},
+			},
+			"digests": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "A digest of the rules of the file of each managed repository, keyed by owner/name",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"results": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "The outcome of the last apply for each repository, keyed by owner/name: the SHA of the commit which changed its file, 'unchanged', or the error which occurred",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// resourceGetter reads the attributes of either a schema.ResourceData or a schema.ResourceDiff.
+type resourceGetter interface {
+	Get(key string) interface{}
+}
+
+// repository is a repository whose CODEOWNERS file is managed by a codeowners_files resource.
+type repository struct {
+	Owner string
+	Name  string
+}
+
+func (r repository) String() string {
+	return r.Owner + "/" + r.Name
+}
+
+// parseRepository parses a repository given as owner/name.
+func parseRepository(fullName string) (repository, error) {
+	parts := strings.Split(fullName, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return repository{}, fmt.Errorf("%q is not a repository - expected owner/name", fullName)
+	}
+	return repository{Owner: parts[0], Name: parts[1]}, nil
+}
+
+// validateRepositoryFullName is a schema.SchemaValidateFunc checking that a repository is given as owner/name.
+func validateRepositoryFullName(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if _, err := parseRepository(v); err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+	return nil, nil
+}
+
+// repositorySelector selects the repositories managed by a codeowners_files resource: either the repositories listed,
+// or those of an organization with the given topics and a name matching the regular expression.
+type repositorySelector struct {
+	Repositories []string
+	Organization string
+	Topics       []string
+	NameRegex    string
+}
+
+func expandRepositorySelector(d resourceGetter) repositorySelector {
+	return repositorySelector{
+		Repositories: expandStringSet(d.Get("repositories")),
+		Organization: d.Get("organization").(string),
+		Topics:       expandStringSet(d.Get("topics")),
+		NameRegex:    d.Get("name_regex").(string),
+	}
+}
+
+// resolve returns the selected repositories, sorted by name. The repositories of an organization are listed through
+// the GitHub API.
+func (s repositorySelector) resolve(ctx context.Context, config *providerConfiguration) ([]repository, error) {
+	var out []repository
+	switch {
+	case s.Organization == "" && len(s.Repositories) == 0:
+		return nil, errors.New("one of repositories or organization must be set")
+	case s.Organization == "":
+		for _, fullName := range s.Repositories {
+			repo, err := parseRepository(fullName)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, repo)
+		}
+	default:
+		var re *regexp.Regexp
+		if s.NameRegex != "" {
+			var err error
+			if re, err = regexp.Compile(s.NameRegex); err != nil {
+				return nil, fmt.Errorf("invalid name_regex: %v", err)
+			}
+		}
+		opts := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			repos, rr, err := config.client.Repositories.ListByOrg(ctx, s.Organization, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list the repositories of %s: %v", s.Organization, err)
+			}
+			for _, r := range repos {
+				if r.GetArchived() || (re != nil && !re.MatchString(r.GetName())) || !hasTopics(r.Topics, s.Topics) {
+					continue
+				}
+				out = append(out, repository{Owner: s.Organization, Name: r.GetName()})
+			}
+			if rr.NextPage == 0 {
+				break
+			}
+			opts.Page = rr.NextPage
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].String() < out[j].String() })
+	return out, nil
+}
+
+// hasTopics returns whether every one of the wanted topics is among the topics of a repository.
+func hasTopics(topics, wanted []string) bool {
+	has := map[string]bool{}
+	for _, topic := range topics {
+		has[topic] = true
+	}
+	for _, topic := range wanted {
+		if !has[topic] {
+			return false
+		}
+	}
+	return true
+}
+
+// repositoryOverride holds the rules of a single repository.
+type repositoryOverride struct {
+	Repository   string
+	ReplaceRules bool
+	Rules        Ruleset
+}
+
+func expandRepositoryOverrides(in []interface{}) []repositoryOverride {
+	var out []repositoryOverride
+	for _, override := range in {
+		override := override.(map[string]interface{})
+		out = append(out, repositoryOverride{
+			Repository:   override["repository"].(string),
+			ReplaceRules: override["replace_rules"].(bool),
+			Rules:        expandRuleset(override["rules"].([]interface{})),
+		})
+	}
+	return out
+}
+
+// repositoryRules returns the rules of the repository: the shared rules, followed by those of its overrides.
+func repositoryRules(shared Ruleset, overrides []repositoryOverride, repo repository) Ruleset {
+	rules := append(Ruleset{}, shared...)
+	for _, override := range overrides {
+		if override.Repository != repo.String() {
+			continue
+		}
+		if override.ReplaceRules {
+			rules = Ruleset{}
+		}
+		rules = append(rules, override.Rules...)
+	}
+	return rules
+}
+
+// rulesetDigest returns a digest of the rules, which depends neither on the layout of the file nor on the order of
+// the owners, so that only changes to the rules themselves are planned.
+func rulesetDigest(rules Ruleset) string {
+	canonical := Ruleset{}
+	for _, rule := range rules {
+		owners := append([]string{}, rule.Usernames...)
+		sort.Strings(owners)
+		rule.Usernames = owners
+		canonical = append(canonical, rule)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(canonical.Compile()))
+}
+
+// forEachRepository calls fn for every repository, with at most parallelism calls running at once. The errors of
+// every call are reported together.
+func forEachRepository(repos []repository, parallelism int, fn func(repository) error) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failures []string
+	for _, repo := range repos {
+		repo := repo
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(repo); err != nil {
+				mu.Lock()
+				failures = append(failures, fmt.Sprintf("%s: %v", repo, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failures) == 0 {
+		return nil
+	}
+	sort.Strings(failures)
+	return fmt.Errorf("failed to manage the CODEOWNERS files of %d repositories:\n  %s", len(failures), strings.Join(failures, "\n  "))
+}
+
+// managedRepositories returns the repositories recorded in the given digests.
+func managedRepositories(digests map[string]interface{}) []repository {
+	var out []repository
+	for fullName := range digests {
+		if repo, err := parseRepository(fullName); err == nil {
+			out = append(out, repo)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].String() < out[j].String() })
+	return out
+}
+
+// resourceFilesCustomizeDiff fails the plan when pull requests would be left open for review, and plans the digests
+// of the rules of the selected repositories, so that the repositories whose files have drifted, or which have been
+// selected or released, show up in the plan.
+func resourceFilesCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	mode := d.Get("commit_mode").(string)
+	if mode == "" && d.NewValueKnown("commit_mode") {
+		mode = m.(*providerConfiguration).commitMode
+	}
+	if mode == commitModeReview {
+		return reviewModeUnsupportedError("codeowners_files")
+	}
+
+	for _, key := range []string{"repositories", "organization", "topics", "name_regex", "rules", "override"} {
+		if !d.NewValueKnown(key) {
+			return nil
+		}
+	}
+
+	repos, err := expandRepositorySelector(d).resolve(context.Background(), m.(*providerConfiguration))
+	if err != nil {
+		return err
+	}
+	shared := expandRuleset(d.Get("rules").([]interface{}))
+	overrides := expandRepositoryOverrides(d.Get("override").([]interface{}))
+
+	planned := map[string]interface{}{}
+	for _, repo := range repos {
+		planned[repo.String()] = rulesetDigest(repositoryRules(shared, overrides, repo))
+	}
+	if reflect.DeepEqual(d.Get("digests").(map[string]interface{}), planned) {
+		return nil
+	}
+	if err := d.SetNew("digests", planned); err != nil {
+		return err
+	}
+	return d.SetNewComputed("results")
+}
+
+func resourceFilesRead(d *schema.ResourceData, m interface{}) error {
+	// The files of the repositories are read concurrently, bounded by parallelism.
+	config := m.(*providerConfiguration).parallel()
+	ctx := context.Background()
+
+	digests := map[string]interface{}{}
+	var mu sync.Mutex
+	err := forEachRepository(managedRepositories(d.Get("digests").(map[string]interface{})), d.Get("parallelism").(int), func(repo repository) error {
+		file := &File{RepositoryOwner: repo.Owner, RepositoryName: repo.Name, Branch: d.Get("branch").(string), Path: d.Get("path").(string)}
+		content, exists, err := getRemoteContent(ctx, config, file)
+		if err != nil {
+			return err
+		}
+		// A missing file never matches the planned digest, so that it is written again.
+		digest := ""
+		if exists {
+			rules, _, _ := file.managedRules(content)
+			digest = rulesetDigest(rules)
+		}
+		mu.Lock()
+		digests[repo.String()] = digest
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return d.Set("digests", digests)
+}
+
+func resourceFilesCreate(d *schema.ResourceData, m interface{}) error {
+	d.SetId(resource.UniqueId())
+	return resourceFilesCreateOrUpdate(d, m)
+}
+
+func resourceFilesUpdate(d *schema.ResourceData, m interface{}) error {
+	return resourceFilesCreateOrUpdate(d, m)
+}
+
+// resourceFilesCreateOrUpdate writes the rules to the files of every selected repository, and releases the files of
+// the repositories which are no longer selected. Repositories which fail don't stop the others from being reconciled.
+func resourceFilesCreateOrUpdate(d *schema.ResourceData, m interface{}) error {
+	// The files of the repositories are read concurrently, bounded by parallelism, and written one at a time.
+	config := m.(*providerConfiguration).parallel()
+	ctx := context.Background()
+
+	repos, err := expandRepositorySelector(d).resolve(ctx, config)
+	if err != nil {
+		return err
+	}
+	shared := expandRuleset(d.Get("rules").([]interface{}))
+	overrides := expandRepositoryOverrides(d.Get("override").([]interface{}))
+	format := expandFormat(d.Get("format").([]interface{}))
+	options, err := filesCommitOptions(d, config)
+	if err != nil {
+		return err
+	}
+
+	selected := map[string]bool{}
+	for _, repo := range repos {
+		selected[repo.String()] = true
+	}
+	for _, override := range overrides {
+		if !selected[override.Repository] {
+			log.Printf("[WARN] the override for %s has no effect, as the repository isn't selected", override.Repository)
+		}
+	}
+	previous, _ := d.GetChange("digests")
+	var released []repository
+	for _, repo := range managedRepositories(previous.(map[string]interface{})) {
+		if !selected[repo.String()] {
+			released = append(released, repo)
+		}
+	}
+	// The files of the repositories which weren't managed yet are only overwritten if told so.
+	adopted := func(repo repository) bool {
+		_, ok := previous.(map[string]interface{})[repo.String()]
+		return ok || d.Get("on_existing").(string) == existingOverwrite
+	}
+
+	results := map[string]interface{}{}
+	// managed keeps track of the repositories to refresh: the selected ones which were adopted, and those which failed
+	// to be released.
+	managed := map[string]interface{}{}
+	var mu sync.Mutex
+	record := func(repo repository, result string, keep bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[repo.String()] = result
+		if keep {
+			managed[repo.String()] = ""
+		}
+	}
+
+	parallelism := d.Get("parallelism").(int)
+	reconcileErr := forEachRepository(repos, parallelism, func(repo repository) error {
+		file := &File{
+			RepositoryOwner: repo.Owner,
+			RepositoryName:  repo.Name,
+			Branch:          d.Get("branch").(string),
+			Path:            d.Get("path").(string),
+			Ruleset:         repositoryRules(shared, overrides, repo),
+			Format:          format,
+		}
+		result, err := reconcileRepositoryFile(ctx, config, file, options, adopted(repo))
+		if err != nil {
+			// A file which wasn't managed yet is left alone, so it isn't overwritten by the next apply either.
+			record(repo, "error: "+err.Error(), adopted(repo))
+			return err
+		}
+		record(repo, result, true)
+		return nil
+	})
+	releaseErr := forEachRepository(released, parallelism, func(repo repository) error {
+		file := &File{RepositoryOwner: repo.Owner, RepositoryName: repo.Name, Branch: d.Get("branch").(string), Path: d.Get("path").(string)}
+		if err := releaseRepositoryFile(ctx, config, file, d.Get("delete_behavior").(string), options); err != nil {
+			record(repo, "error: "+err.Error(), true)
+			return err
+		}
+		return nil
+	})
+
+	if err := d.Set("results", results); err != nil {
+		return err
+	}
+	if err := d.Set("digests", managed); err != nil {
+		return err
+	}
+	readErr := resourceFilesRead(d, m)
+
+	var messages []string
+	for _, err := range []error{reconcileErr, releaseErr, readErr} {
+		if err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+	if len(messages) > 0 {
+		return errors.New(strings.Join(messages, "\n"))
+	}
+	return nil
+}
+
+func resourceFilesDelete(d *schema.ResourceData, m interface{}) error {
+	// The files of the repositories are read concurrently, bounded by parallelism, and written one at a time.
+	config := m.(*providerConfiguration).parallel()
+	ctx := context.Background()
+
+	behavior := d.Get("delete_behavior").(string)
+	if behavior == deleteAbandon {
+		return nil
+	}
+	options, err := filesCommitOptions(d, config)
+	if err != nil {
+		return err
+	}
+	return forEachRepository(managedRepositories(d.Get("digests").(map[string]interface{})), d.Get("parallelism").(int), func(repo repository) error {
+		file := &File{RepositoryOwner: repo.Owner, RepositoryName: repo.Name, Branch: d.Get("branch").(string), Path: d.Get("path").(string)}
+		return releaseRepositoryFile(ctx, config, file, behavior, options)
+	})
+}
+
+// filesCommitOptions returns the settings shared by the commits made to every repository. Pull requests left open
+// for review cannot be tracked per repository, which fails the plan already, but destroying doesn't go through it.
+func filesCommitOptions(d *schema.ResourceData, config *providerConfiguration) (commitOptions, error) {
+	mode := commitMode(d, config)
+	if mode == commitModeReview {
+		return commitOptions{}, reviewModeUnsupportedError("codeowners_files")
+	}
+	return commitOptions{
+		Mode:               mode,
+		PullRequestOptions: pullRequestSettings(d, config),
+	}, nil
+}
+
+// reconcileRepositoryFile writes the file if its content differs from the rendered rules, returning the SHA of the
+// commit which changed it, or resultUnchanged. Unless overwrite is set, an existing file with other rules is left as
+// it is and reported as an error.
+func reconcileRepositoryFile(ctx context.Context, config *providerConfiguration, file *File, options commitOptions, overwrite bool) (string, error) {
+	if file.Branch == "" {
+		b, err := branch.GetDefaultBranch(ctx, config.client, file.RepositoryOwner, file.RepositoryName)
+		if err != nil {
+			return "", err
+		}
+		file.Branch = b
+	}
+	format, err := file.Format.render(file)
+	if err != nil {
+		return "", err
+	}
+	file.Format = format
+
+	existing, exists, err := getRemoteContent(ctx, config, file)
+	if err != nil {
+		return "", err
+	}
+	content := file.render(existing)
+	if exists && existing == content {
+		return resultUnchanged, nil
+	}
+	if exists && !overwrite {
+		if rules, sections, _ := file.managedRules(existing); len(rules) > 0 || len(sections) > 0 {
+			return "", fmt.Errorf("%s already exists with %d rules - set on_existing to %q to overwrite it",
+				file.Path, len(rules)+countSectionRules(sections), existingOverwrite)
+		}
+	}
+
+	message := "Adding CODEOWNERS file"
+	if exists {
+		message = "Updating CODEOWNERS file"
+	}
+	options.RepoOwner = file.RepositoryOwner
+	options.RepoName = file.RepositoryName
+	options.Branch = file.Branch
+	options.CommitMessage = formatCommitMessage(config.commitMessagePrefix, message)
+	options.Changes = []*github.TreeEntry{
+		{
+			Path:    github.String(file.Path),
+			Content: github.String(content),
+			Type:    github.String("blob"),
+			Mode:    github.String("100644"),
+		},
+	}
+	result, err := config.createCommit(ctx, &options)
+	if err != nil {
+		return "", err
+	}
+	return result.CommitSHA, nil
+}
+
+// releaseRepositoryFile deletes or empties the file of a repository which is no longer managed, according to the
+// delete behavior.
+func releaseRepositoryFile(ctx context.Context, config *providerConfiguration, file *File, behavior string, options commitOptions) error {
+	if behavior == deleteAbandon {
+		return nil
+	}
+	_, exists, err := getRemoteContent(ctx, config, file)
+	if err != nil || !exists {
+		return err
+	}
+
+	message := "Deleting CODEOWNERS file"
+	if behavior == deleteEmptyFile {
+		message = "Emptying CODEOWNERS file"
+	}
+
+	options.RepoOwner = file.RepositoryOwner
+	options.RepoName = file.RepositoryName
+	options.Branch = file.Branch
+	options.CommitMessage = formatCommitMessage(config.commitMessagePrefix, message)
+	options.Changes = []*github.TreeEntry{deletionEntry(file.Path, behavior)}
+	_, err = config.createCommit(ctx, &options)
+	return err
+}
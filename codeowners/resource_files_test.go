@@ -0,0 +1,231 @@
+package codeowners
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositorySelectorResolve(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.mux.HandleFunc("/orgs/my-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"name": "service-b", "topics": ["backend", "go"]}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/orgs/my-org/repos?page=2>; rel="next"`, f.URL))
+		fmt.Fprint(w, `[
+			{"name": "service-a", "topics": ["backend"]},
+			{"name": "service-c", "topics": ["backend"], "archived": true},
+			{"name": "website", "topics": ["backend"]},
+			{"name": "service-d", "topics": []}
+		]`)
+	})
+	config := f.config(t)
+
+	repos, err := repositorySelector{Organization: "my-org", Topics: []string{"backend"}, NameRegex: "^service-"}.resolve(context.Background(), config)
+	require.NoError(t, err)
+	assert.Equal(t, []repository{{Owner: "my-org", Name: "service-a"}, {Owner: "my-org", Name: "service-b"}}, repos)
+
+	repos, err = repositorySelector{Repositories: []string{"o/b", "o/a"}}.resolve(context.Background(), config)
+	require.NoError(t, err)
+	assert.Equal(t, []repository{{Owner: "o", Name: "a"}, {Owner: "o", Name: "b"}}, repos)
+
+	_, err = repositorySelector{}.resolve(context.Background(), config)
+	assert.EqualError(t, err, "one of repositories or organization must be set")
+}
+
+func TestRepositoryRules(t *testing.T) {
+	shared := Ruleset{{Pattern: "*", Usernames: []string{"expert"}}}
+	overrides := []repositoryOverride{
+		{Repository: "o/a", Rules: Ruleset{{Pattern: "*.go", Usernames: []string{"gopher"}}}},
+		{Repository: "o/b", ReplaceRules: true, Rules: Ruleset{{Pattern: "*", Usernames: []string{"someone-else"}}}},
+	}
+
+	assert.Equal(t, Ruleset{{Pattern: "*", Usernames: []string{"expert"}}, {Pattern: "*.go", Usernames: []string{"gopher"}}},
+		repositoryRules(shared, overrides, repository{Owner: "o", Name: "a"}))
+	assert.Equal(t, Ruleset{{Pattern: "*", Usernames: []string{"someone-else"}}}, repositoryRules(shared, overrides, repository{Owner: "o", Name: "b"}))
+	assert.Equal(t, shared, repositoryRules(shared, overrides, repository{Owner: "o", Name: "c"}))
+}
+
+func TestRulesetDigest(t *testing.T) {
+	rules := Ruleset{{Pattern: "*", Usernames: []string{"my-org/experts", "expert"}}}
+	file := &File{Ruleset: rules, Format: Format{AlignOwners: true, TeamsFirst: true, Header: "managed elsewhere"}}
+
+	// Neither the layout of the file nor the order of the owners changes the digest.
+	parsed, err := parseRulesFile(string(file.compile()))
+	require.NoError(t, err)
+	assert.Equal(t, rulesetDigest(rules), rulesetDigest(parsed))
+	assert.Equal(t, rulesetDigest(Ruleset{}), rulesetDigest(nil))
+	assert.NotEqual(t, rulesetDigest(rules), rulesetDigest(Ruleset{{Pattern: "*", Usernames: []string{"expert"}}}))
+}
+
+func TestForEachRepositoryReportsEveryFailure(t *testing.T) {
+	repos := []repository{{Owner: "o", Name: "a"}, {Owner: "o", Name: "b"}, {Owner: "o", Name: "c"}}
+	err := forEachRepository(repos, 2, func(repo repository) error {
+		if repo.Name == "b" {
+			return nil
+		}
+		return fmt.Errorf("broken")
+	})
+	assert.EqualError(t, err, "failed to manage the CODEOWNERS files of 2 repositories:\n  o/a: broken\n  o/c: broken")
+}
+
+func TestResourceFilesCreate(t *testing.T) {
+	expected := "# automatically generated by terraform - please do not edit here\n* @expert\n"
+	f := newFakeGitHub(t)
+	// o/a already has the expected content, while o/b has no file yet.
+	f.handle("/repos/o/a/contents/.github/CODEOWNERS", http.StatusOK, fmt.Sprintf(`{"type": "file", "encoding": "base64", "content": %q}`, base64.StdEncoding.EncodeToString([]byte(expected))))
+	f.handle("/repos/o/b/contents/.github/CODEOWNERS", http.StatusNotFound, `{"message": "Not Found"}`)
+	f.handle("/repos/o/b/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+	f.handle("/repos/o/b/commits/head", http.StatusOK, `{"sha": "head", "commit": {}}`)
+	f.handle("/repos/o/b/git/commits", http.StatusCreated, `{"sha": "new-commit"}`)
+	f.handle("/repos/o/b/git/refs/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "new-commit"}}`)
+	var tree map[string]interface{}
+	f.mux.HandleFunc("/repos/o/b/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&tree))
+		fmt.Fprint(w, `{"sha": "tree"}`)
+	})
+
+	d := resourceFiles().TestResourceData()
+	require.NoError(t, d.Set("repositories", []interface{}{"o/a", "o/b"}))
+	require.NoError(t, d.Set("branch", "main"))
+	require.NoError(t, d.Set("path", ".github/CODEOWNERS"))
+	require.NoError(t, d.Set("commit_mode", commitModePush))
+	require.NoError(t, d.Set("rules", flattenRuleset(Ruleset{{Pattern: "*", Usernames: []string{"expert"}}})))
+
+	require.NoError(t, resourceFilesCreate(d, f.config(t)))
+
+	assert.NotEmpty(t, d.Id())
+	assert.Equal(t, map[string]interface{}{"o/a": resultUnchanged, "o/b": "new-commit"}, d.Get("results"))
+	assert.Equal(t, []interface{}{map[string]interface{}{"path": ".github/CODEOWNERS", "type": "blob", "mode": "100644", "content": expected}}, tree["tree"])
+	assert.False(t, f.made("POST /repos/o/a/git/trees"))
+	// The digests are refreshed from the files, and the fake never sees o/b's file appear.
+	assert.Equal(t, map[string]interface{}{"o/a": rulesetDigest(Ruleset{{Pattern: "*", Usernames: []string{"expert"}}}), "o/b": ""}, d.Get("digests"))
+}
+
+func TestResourceFilesCreateReportsFailures(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/a/contents/.github/CODEOWNERS", http.StatusInternalServerError, `{"message": "oops"}`)
+
+	d := resourceFiles().TestResourceData()
+	require.NoError(t, d.Set("repositories", []interface{}{"o/a"}))
+	require.NoError(t, d.Set("branch", "main"))
+	require.NoError(t, d.Set("path", ".github/CODEOWNERS"))
+
+	err := resourceFilesCreate(d, f.config(t))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to manage the CODEOWNERS files of 1 repositories:\n  o/a: ")
+	assert.Contains(t, d.Get("results.o/a"), "error: ")
+}
+
+func TestResourceFilesCreateLeavesExistingFiles(t *testing.T) {
+	existing := "* @someone-else\n"
+	for _, onExisting := range []string{existingFail, existingOverwrite} {
+		t.Run(onExisting, func(t *testing.T) {
+			f := newFakeGitHub(t)
+			f.handle("/repos/o/a/contents/.github/CODEOWNERS", http.StatusOK, fmt.Sprintf(`{"type": "file", "encoding": "base64", "content": %q}`, base64.StdEncoding.EncodeToString([]byte(existing))))
+			f.handle("/repos/o/a/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+			f.handle("/repos/o/a/git/trees", http.StatusCreated, `{"sha": "tree"}`)
+			f.handle("/repos/o/a/commits/head", http.StatusOK, `{"sha": "head", "commit": {}}`)
+			f.handle("/repos/o/a/git/commits", http.StatusCreated, `{"sha": "new-commit"}`)
+			f.handle("/repos/o/a/git/refs/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "new-commit"}}`)
+
+			d := resourceFiles().TestResourceData()
+			require.NoError(t, d.Set("repositories", []interface{}{"o/a"}))
+			require.NoError(t, d.Set("branch", "main"))
+			require.NoError(t, d.Set("path", ".github/CODEOWNERS"))
+			require.NoError(t, d.Set("commit_mode", commitModePush))
+			require.NoError(t, d.Set("on_existing", onExisting))
+			require.NoError(t, d.Set("rules", flattenRuleset(Ruleset{{Pattern: "*", Usernames: []string{"expert"}}})))
+
+			err := resourceFilesCreate(d, f.config(t))
+			if onExisting == existingOverwrite {
+				require.NoError(t, err)
+				assert.Equal(t, "new-commit", d.Get("results.o/a"))
+				assert.True(t, f.made("POST /repos/o/a/git/trees"))
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), `o/a: .github/CODEOWNERS already exists with 1 rules - set on_existing to "overwrite" to overwrite it`)
+			assert.False(t, f.made("POST /repos/o/a/git/trees"))
+			// The repository isn't managed, so the next apply doesn't overwrite the file either.
+			assert.Empty(t, d.Get("digests"))
+		})
+	}
+}
+
+func TestResourceFilesLocationChangesReplaceTheResource(t *testing.T) {
+	state := &terraform.InstanceState{
+		ID: "files",
+		Attributes: map[string]string{
+			"id":              "files",
+			"repositories.#":  "1",
+			"branch":          "",
+			"path":            ".github/CODEOWNERS",
+			"parallelism":     "10",
+			"delete_behavior": deleteRemoveFile,
+			"digests.%":       "1",
+			"digests.o/a":     rulesetDigest(nil),
+		},
+	}
+	state.Attributes[fmt.Sprintf("repositories.%d", schema.HashString("o/a"))] = "o/a"
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"repositories": []interface{}{"o/a"},
+		"path":         "docs/CODEOWNERS",
+	})
+
+	diff, err := resourceFiles().Diff(state, config, &providerConfiguration{})
+	require.NoError(t, err)
+	require.NotNil(t, diff)
+	assert.True(t, diff.RequiresNew())
+	assert.True(t, diff.Attributes["path"].RequiresNew)
+}
+
+func TestResourceFilesReviewModeFailsThePlan(t *testing.T) {
+	for name, tc := range map[string]struct {
+		resourceMode string
+		providerMode string
+		fails        bool
+	}{
+		"provider":          {providerMode: commitModeReview, fails: true},
+		"resource":          {resourceMode: commitModeReview, providerMode: commitModeMerge, fails: true},
+		"resource override": {resourceMode: commitModePush, providerMode: commitModeReview},
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := map[string]interface{}{"repositories": []interface{}{"o/a"}}
+			if tc.resourceMode != "" {
+				raw["commit_mode"] = tc.resourceMode
+			}
+
+			_, err := resourceFiles().Diff(nil, terraform.NewResourceConfigRaw(raw), &providerConfiguration{commitMode: tc.providerMode})
+			if tc.fails {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), `the "review" commit mode is not supported by codeowners_files`)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestResourceFilesDeleteFailsInReviewMode(t *testing.T) {
+	f := newFakeGitHub(t)
+	config := f.config(t)
+	config.commitMode = commitModeReview
+
+	d := resourceFiles().TestResourceData()
+	require.NoError(t, d.Set("delete_behavior", deleteRemoveFile))
+	require.NoError(t, d.Set("digests", map[string]interface{}{"o/a": ""}))
+
+	require.Error(t, resourceFilesDelete(d, config))
+	assert.Empty(t, f.requests)
+}
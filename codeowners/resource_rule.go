@@ -0,0 +1,342 @@
+package codeowners
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/validation"
+)
+
+const defaultRulesSection = "terraform-rules"
+
+const ruleWeightPrefix = "# weight: "
+
+func resourceRule() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceRuleCreate,
+		Read:   resourceRuleRead,
+		Update: resourceRuleUpdate,
+		Delete: resourceRuleDelete,
+		Importer: &schema.ResourceImporter{
+			State: resourceRuleImport,
+		},
+		CustomizeDiff: resourceRuleCustomizeDiff,
+		Schema: map[string]*schema.Schema{
+			"repository_owner": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The repository owner e.g. my-org if the repo is my-org/my-repo",
+				ForceNew:    true,
+			},
+			"repository_name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The repository name e.g. my-repo",
+				ForceNew:    true,
+			},
+			"branch": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The branch to control CODEOWNERS on - defaults to the default repo branch",
+				Default:     "",
+				ForceNew:    true,
+			},
+			"path": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "The location of the CODEOWNERS file: '.github/CODEOWNERS', 'CODEOWNERS' or 'docs/CODEOWNERS'",
+				Default:      defaultCodeownersPath,
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice(codeownersPaths, false),
+			},
+			"managed_section": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The section of the CODEOWNERS file, delimited by '# BEGIN <managed_section>' and '# END <managed_section>' lines, the rule is written to",
+				Default:     defaultRulesSection,
+				ForceNew:    true,
+			},
+			"pattern": {
+				Type:         schema.TypeString,
+				Required:     true,
+				Description:  "A pattern which follows the same rules used in gitignore files",
+				ForceNew:     true,
+				ValidateFunc: validatePattern,
+			},
+			"usernames": {
+				Type:        schema.TypeSet,
+				ConfigMode:  schema.SchemaConfigModeAttr,
+				Required:    true,
+				Description: "A list of owners using the standard @username or @org/team-name format, or email addresses - using the @ prefix for users and teams is entirely optional",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateOwner,
+				},
+				Set:              schema.HashString,
+				DiffSuppressFunc: usernamesDiffSupressFunc,
+			},
+			"weight": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Rules are ordered by ascending weight within the section - since the last matching rule wins, rules with a higher weight take precedence",
+				Default:     0,
+			},
+		},
+	}
+}
+
+// weightedRule is a rule contributed by a codeowners_rule resource.
+type weightedRule struct {
+	Rule
+	Weight int
+}
+
+// ruleChange is a change a codeowners_rule resource makes to the section of the file it contributes to.
+type ruleChange struct {
+	Rule   weightedRule
+	Remove bool
+}
+
+// ruleTarget identifies the section of a CODEOWNERS file codeowners_rule resources contribute to.
+type ruleTarget struct {
+	RepositoryOwner string
+	RepositoryName  string
+	Branch          string
+	Path            string
+	ManagedSection  string
+}
+
+func (t ruleTarget) key() string {
+	return fmt.Sprintf("%s/%s:%s:%s:%s", t.RepositoryOwner, t.RepositoryName, t.Branch, t.Path, t.ManagedSection)
+}
+
+func (t ruleTarget) file() *File {
+	return &File{
+		RepositoryOwner: t.RepositoryOwner,
+		RepositoryName:  t.RepositoryName,
+		Branch:          t.Branch,
+		Path:            t.Path,
+		ManagedSection:  t.ManagedSection,
+	}
+}
+
+// parseWeightedRules parses the content of a section written by codeowners_rule resources.
+func parseWeightedRules(section string) []weightedRule {
+	var out []weightedRule
+	weight := 0
+	for _, line := range strings.Split(section, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ruleWeightPrefix) {
+			if w, err := strconv.Atoi(strings.TrimPrefix(trimmed, ruleWeightPrefix)); err == nil {
+				weight = w
+			}
+			continue
+		}
+		rules, err := parseRulesFile(trimmed)
+		if err != nil {
+			log.Printf("[WARN] skipped a rule which could not be interpreted: %v", err)
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		out = append(out, weightedRule{Rule: rules[0], Weight: weight})
+		weight = 0
+	}
+	return out
+}
+
+// compileWeightedRules renders rules contributed by codeowners_rule resources, in ascending order of weight.
+func compileWeightedRules(rules []weightedRule) []byte {
+	sorted := make([]weightedRule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Weight < sorted[j].Weight
+	})
+
+	var sb strings.Builder
+	for _, rule := range sorted {
+		if rule.Weight != 0 {
+			sb.WriteString(fmt.Sprintf("%s%d\n", ruleWeightPrefix, rule.Weight))
+		}
+		sb.WriteString(rule.Compile() + "\n")
+	}
+	return []byte(sb.String())
+}
+
+// applyRuleChanges applies changes to the rules of a section, replacing any existing rules with the same pattern.
+func applyRuleChanges(rules []weightedRule, changes []ruleChange) []weightedRule {
+	for _, change := range changes {
+		var out []weightedRule
+		replaced := false
+		for _, rule := range rules {
+			if rule.Pattern != change.Rule.Pattern {
+				out = append(out, rule)
+				continue
+			}
+			if !change.Remove && !replaced {
+				out = append(out, change.Rule)
+				replaced = true
+			}
+		}
+		if !change.Remove && !replaced {
+			out = append(out, change.Rule)
+		}
+		rules = out
+	}
+	return rules
+}
+
+// resourceRuleCustomizeDiff fails the plan when the provider opens pull requests for review, as rules cannot track
+// them.
+func resourceRuleCustomizeDiff(_ *schema.ResourceDiff, m interface{}) error {
+	if config, ok := m.(*providerConfiguration); ok && config.commitMode == commitModeReview {
+		return reviewModeUnsupportedError("codeowners_rule")
+	}
+	return nil
+}
+
+func resourceRuleImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	if err := d.Set("path", defaultCodeownersPath); err != nil {
+		return nil, err
+	}
+	if err := d.Set("managed_section", defaultRulesSection); err != nil {
+		return nil, err
+	}
+	err := resourceRuleRead(d, m)
+	return []*schema.ResourceData{d}, err
+}
+
+func resourceRuleRead(d *schema.ResourceData, m interface{}) error {
+	config := m.(*providerConfiguration)
+
+	target, rule := expandRule(d)
+
+	content, exists, err := getRemoteContent(context.Background(), config, target.file())
+	if err != nil {
+		return err
+	}
+	section, ok := extractManagedSection(content, target.ManagedSection)
+	if !exists || !ok {
+		d.SetId("")
+		return nil
+	}
+
+	for _, r := range parseWeightedRules(section) {
+		if r.Pattern == rule.Pattern {
+			return flattenRule(target, r, d)
+		}
+	}
+
+	d.SetId("")
+	return nil
+}
+
+func resourceRuleCreate(d *schema.ResourceData, m interface{}) error {
+	if err := resourceRuleApply(d, m, false); err != nil {
+		return err
+	}
+	return resourceRuleRead(d, m)
+}
+
+func resourceRuleUpdate(d *schema.ResourceData, m interface{}) error {
+	if err := resourceRuleApply(d, m, false); err != nil {
+		return err
+	}
+	return resourceRuleRead(d, m)
+}
+
+func resourceRuleDelete(d *schema.ResourceData, m interface{}) error {
+	return resourceRuleApply(d, m, true)
+}
+
+// resourceRuleApply hands the change over to the batcher, so that changes made to the same file during an apply end
+// up in a single commit.
+func resourceRuleApply(d *schema.ResourceData, m interface{}, remove bool) error {
+	config := m.(*providerConfiguration)
+
+	target, rule := expandRule(d)
+	if target.Branch == "" {
+		rep, _, err := config.client.Repositories.Get(context.Background(), target.RepositoryOwner, target.RepositoryName)
+		if err != nil {
+			return err
+		}
+		target.Branch = rep.GetDefaultBranch()
+	}
+
+	if err := config.ruleBatcher.apply(target, ruleChange{Rule: rule, Remove: remove}); err != nil {
+		return err
+	}
+
+	if !remove {
+		d.SetId(formatRuleID(d.Get("branch").(string), target, rule))
+	}
+	return nil
+}
+
+func formatRuleID(branch string, target ruleTarget, rule weightedRule) string {
+	return fmt.Sprintf("%s/%s:%s:%s", target.RepositoryOwner, target.RepositoryName, branch, rule.Pattern)
+}
+
+func flattenRule(target ruleTarget, rule weightedRule, d *schema.ResourceData) error {
+	d.SetId(formatRuleID(target.Branch, target, rule))
+	if err := d.Set("repository_name", target.RepositoryName); err != nil {
+		return err
+	}
+	if err := d.Set("repository_owner", target.RepositoryOwner); err != nil {
+		return err
+	}
+	if err := d.Set("branch", target.Branch); err != nil {
+		return err
+	}
+	if err := d.Set("pattern", rule.Pattern); err != nil {
+		return err
+	}
+	if err := d.Set("usernames", schema.NewSet(schema.HashString, flattenStringList(rule.Usernames))); err != nil {
+		return err
+	}
+	return d.Set("weight", rule.Weight)
+}
+
+func expandRule(d *schema.ResourceData) (ruleTarget, weightedRule) {
+	target := ruleTarget{
+		RepositoryOwner: d.Get("repository_owner").(string),
+		RepositoryName:  d.Get("repository_name").(string),
+		Branch:          d.Get("branch").(string),
+		Path:            d.Get("path").(string),
+		ManagedSection:  d.Get("managed_section").(string),
+	}
+	pattern := d.Get("pattern").(string)
+
+	// support imports
+	if d.Id() != "" {
+		parts := strings.SplitN(d.Id(), "/", 2)
+		if len(parts) == 2 {
+			target.RepositoryOwner = parts[0]
+			subs := strings.SplitN(parts[1], ":", 3)
+			if len(subs) == 3 {
+				target.RepositoryName = subs[0]
+				target.Branch = subs[1]
+				pattern = subs[2]
+			}
+		}
+	}
+
+	var usernames []string
+	for _, username := range d.Get("usernames").(*schema.Set).List() {
+		usernames = append(usernames, normaliseOwner(username.(string)))
+	}
+	sort.Strings(usernames)
+
+	return target, weightedRule{
+		Rule: Rule{
+			Pattern:   pattern,
+			Usernames: usernames,
+		},
+		Weight: d.Get("weight").(int),
+	}
+}
@@ -0,0 +1,204 @@
+package codeowners
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAccRuleConfig = `
+	resource "codeowners_rule" "go" {
+		repository_name  = "enforcement-test-repo"
+		repository_owner = "form3tech-oss"
+		pattern          = "*.go"
+		usernames        = [ "go-expert" ]
+		weight           = 10
+	}
+
+	resource "codeowners_rule" "java" {
+		repository_name  = "enforcement-test-repo"
+		repository_owner = "form3tech-oss"
+		pattern          = "*.java"
+		usernames        = [ "java-expert", "java-guru" ]
+	}`
+
+func TestAccResourceRule_basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccRuleConfig,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("codeowners_rule.go", "pattern", "*.go"),
+					resource.TestCheckResourceAttr("codeowners_rule.go", "usernames.#", "1"),
+					resource.TestCheckResourceAttr("codeowners_rule.go", "weight", "10"),
+					resource.TestCheckResourceAttr("codeowners_rule.java", "pattern", "*.java"),
+					resource.TestCheckResourceAttr("codeowners_rule.java", "usernames.#", "2"),
+					resource.TestCheckResourceAttr("codeowners_rule.java", "weight", "0"),
+				),
+			},
+			{
+				ResourceName:      "codeowners_rule.java",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestWeightedRulesRoundTrip(t *testing.T) {
+	rules := []weightedRule{
+		{Rule: Rule{Pattern: "*.go", Usernames: []string{"go-expert"}}, Weight: 10},
+		{Rule: Rule{Pattern: "*", Usernames: []string{"expert"}}, Weight: -1},
+		{Rule: Rule{Pattern: "*.java", Usernames: []string{"java-expert", "java-guru"}}},
+	}
+
+	compiled := string(compileWeightedRules(rules))
+	assert.Equal(t, "# weight: -1\n* @expert\n*.java @java-expert @java-guru\n# weight: 10\n*.go @go-expert\n", compiled)
+
+	assert.Equal(t, []weightedRule{rules[1], rules[2], rules[0]}, parseWeightedRules(compiled))
+}
+
+func TestApplyRuleChanges(t *testing.T) {
+	rules := []weightedRule{
+		{Rule: Rule{Pattern: "*", Usernames: []string{"expert"}}},
+		{Rule: Rule{Pattern: "*.go", Usernames: []string{"go-expert"}}},
+	}
+
+	actual := applyRuleChanges(rules, []ruleChange{
+		{Rule: weightedRule{Rule: Rule{Pattern: "*.go", Usernames: []string{"gopher"}}, Weight: 1}},
+		{Rule: weightedRule{Rule: Rule{Pattern: "*"}}, Remove: true},
+		{Rule: weightedRule{Rule: Rule{Pattern: "*.java", Usernames: []string{"java-expert"}}}},
+	})
+
+	assert.Equal(t, []weightedRule{
+		{Rule: Rule{Pattern: "*.go", Usernames: []string{"gopher"}}, Weight: 1},
+		{Rule: Rule{Pattern: "*.java", Usernames: []string{"java-expert"}}},
+	}, actual)
+}
+
+func TestRuleBatcherCommitsConcurrentChangesTogether(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/r/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+	f.handle("/repos/o/r/commits/head", http.StatusOK, `{"sha": "head", "commit": {}}`)
+	f.handle("/repos/o/r/git/commits", http.StatusCreated, `{"sha": "new-commit"}`)
+	f.handle("/repos/o/r/contents/.github/CODEOWNERS", http.StatusNotFound, `{}`)
+	f.handle("/repos/o/r/git/refs/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "new-commit"}}`)
+
+	var commits int
+	var tree map[string]interface{}
+	f.mux.HandleFunc("/repos/o/r/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		commits++
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&tree))
+		fmt.Fprint(w, `{"sha": "tree"}`)
+	})
+
+	config := f.config(t)
+	config.commitMode = commitModePush
+	batcher := newRuleBatcher(config, 50*time.Millisecond)
+
+	target := ruleTarget{RepositoryOwner: "o", RepositoryName: "r", Branch: "main", Path: ".github/CODEOWNERS", ManagedSection: defaultRulesSection}
+	changes := []ruleChange{
+		{Rule: weightedRule{Rule: Rule{Pattern: "*.go", Usernames: []string{"go-expert"}}, Weight: 1}},
+		{Rule: weightedRule{Rule: Rule{Pattern: "*", Usernames: []string{"expert"}}}},
+	}
+
+	var wg sync.WaitGroup
+	for _, change := range changes {
+		wg.Add(1)
+		go func(change ruleChange) {
+			defer wg.Done()
+			assert.NoError(t, batcher.apply(target, change))
+		}(change)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, commits)
+	entries := tree["tree"].([]interface{})
+	require.Len(t, entries, 1)
+	assert.Equal(t, "# BEGIN terraform-rules\n* @expert\n# weight: 1\n*.go @go-expert\n# END terraform-rules\n", entries[0].(map[string]interface{})["content"])
+}
+
+func TestRuleBatcherCommitsToTheSameFileOneAtATime(t *testing.T) {
+	f := newFakeGitHub(t)
+	f.handle("/repos/o/r/git/ref/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "head"}}`)
+	f.handle("/repos/o/r/commits/head", http.StatusOK, `{"sha": "head", "commit": {}}`)
+	f.handle("/repos/o/r/git/commits", http.StatusCreated, `{"sha": "new-commit"}`)
+	f.handle("/repos/o/r/contents/.github/CODEOWNERS", http.StatusNotFound, `{}`)
+	f.handle("/repos/o/r/git/refs/heads/main", http.StatusOK, `{"ref": "refs/heads/main", "object": {"sha": "new-commit"}}`)
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight, commits int
+	f.mux.HandleFunc("/repos/o/r/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		commits++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		// Keep the first commit in flight while the second batch starts.
+		time.Sleep(100 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		fmt.Fprint(w, `{"sha": "tree"}`)
+	})
+
+	config := f.config(t)
+	config.commitMode = commitModePush
+	batcher := newRuleBatcher(config, 10*time.Millisecond)
+
+	target := ruleTarget{RepositoryOwner: "o", RepositoryName: "r", Branch: "main", Path: ".github/CODEOWNERS", ManagedSection: defaultRulesSection}
+	var wg sync.WaitGroup
+	for i, pattern := range []string{"*.go", "*.js"} {
+		wg.Add(1)
+		go func(delay time.Duration, pattern string) {
+			defer wg.Done()
+			time.Sleep(delay)
+			assert.NoError(t, batcher.apply(target, ruleChange{Rule: weightedRule{Rule: Rule{Pattern: pattern, Usernames: []string{"expert"}}}}))
+		}(time.Duration(i)*50*time.Millisecond, pattern)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 2, commits)
+	assert.Equal(t, 1, maxInFlight)
+}
+
+func TestResourceRuleReviewModeFailsThePlan(t *testing.T) {
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"repository_owner": "o",
+		"repository_name":  "r",
+		"pattern":          "*.go",
+		"usernames":        []interface{}{"go-expert"},
+	})
+
+	_, err := resourceRule().Diff(nil, config, &providerConfiguration{commitMode: commitModeReview})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `the "review" commit mode is not supported by codeowners_rule`)
+
+	diff, err := resourceRule().Diff(nil, config, &providerConfiguration{commitMode: commitModeMerge})
+	require.NoError(t, err)
+	assert.NotNil(t, diff)
+}
+
+func TestRuleBatcherFailsInReviewMode(t *testing.T) {
+	f := newFakeGitHub(t)
+	config := f.config(t)
+	config.commitMode = commitModeReview
+	batcher := newRuleBatcher(config, 10*time.Millisecond)
+
+	target := ruleTarget{RepositoryOwner: "o", RepositoryName: "r", Branch: "main", Path: ".github/CODEOWNERS", ManagedSection: defaultRulesSection}
+	err := batcher.apply(target, ruleChange{Rule: weightedRule{Rule: Rule{Pattern: "*.go"}}, Remove: true})
+	require.Error(t, err)
+	assert.False(t, f.made("POST /repos/o/r/git/trees"))
+}
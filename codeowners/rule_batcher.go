@@ -0,0 +1,117 @@
+package codeowners
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v54/github"
+)
+
+// ruleBatchDelay is how long the batcher waits for further changes to the same file before committing. Terraform
+// applies independent resources concurrently, so this is enough to catch all the rules changed in one apply.
+const ruleBatchDelay = 2 * time.Second
+
+// ruleBatch collects the changes made to the same file, which are committed together.
+type ruleBatch struct {
+	changes []ruleChange
+	done    chan struct{}
+	err     error
+}
+
+// ruleBatcher batches the changes codeowners_rule resources make to the same file into a single commit.
+type ruleBatcher struct {
+	config *providerConfiguration
+	delay  time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*ruleBatch
+	// committing serialises the commits to the same file, so that a batch started while another is being committed
+	// reads the file once the other has landed.
+	committing map[string]*sync.Mutex
+}
+
+func newRuleBatcher(config *providerConfiguration, delay time.Duration) *ruleBatcher {
+	return &ruleBatcher{
+		config:     config,
+		delay:      delay,
+		pending:    map[string]*ruleBatch{},
+		committing: map[string]*sync.Mutex{},
+	}
+}
+
+// apply adds the change to the batch for the target file and waits for the batch to be committed.
+func (b *ruleBatcher) apply(target ruleTarget, change ruleChange) error {
+	key := target.key()
+
+	b.mu.Lock()
+	batch, ok := b.pending[key]
+	if !ok {
+		batch = &ruleBatch{done: make(chan struct{})}
+		b.pending[key] = batch
+		time.AfterFunc(b.delay, func() {
+			b.mu.Lock()
+			delete(b.pending, key)
+			lock, ok := b.committing[key]
+			if !ok {
+				lock = &sync.Mutex{}
+				b.committing[key] = lock
+			}
+			b.mu.Unlock()
+
+			lock.Lock()
+			batch.err = b.commit(target, batch.changes)
+			lock.Unlock()
+			close(batch.done)
+		})
+	}
+	batch.changes = append(batch.changes, change)
+	b.mu.Unlock()
+
+	<-batch.done
+	return batch.err
+}
+
+// commit applies a batch of changes to the target file in a single commit.
+func (b *ruleBatcher) commit(target ruleTarget, changes []ruleChange) error {
+	// The plan fails already, but destroying rules doesn't go through it.
+	if b.config.commitMode == commitModeReview {
+		return reviewModeUnsupportedError("codeowners_rule")
+	}
+	ctx := context.Background()
+	file := target.file()
+
+	content, exists, err := getRemoteContent(ctx, b.config, file)
+	if err != nil {
+		return err
+	}
+
+	section, _ := extractManagedSection(content, target.ManagedSection)
+	rules := applyRuleChanges(parseWeightedRules(section), changes)
+
+	updated := removeManagedSection(content, target.ManagedSection)
+	if len(rules) > 0 {
+		updated = replaceManagedSection(content, target.ManagedSection, compileWeightedRules(rules))
+	}
+	if updated == content {
+		return nil
+	}
+
+	// Delete the file once nothing is left in it.
+	entry := deletionEntry(target.Path, deleteRemoveFile)
+	if strings.TrimSpace(updated) != "" || !exists {
+		entry.Content = github.String(updated)
+	}
+
+	_, err = b.config.createCommit(ctx, &commitOptions{
+		RepoOwner:          target.RepositoryOwner,
+		RepoName:           target.RepositoryName,
+		Branch:             target.Branch,
+		CommitMessage:      formatCommitMessage(b.config.commitMessagePrefix, "Updating CODEOWNERS rules"),
+		Changes:            []*github.TreeEntry{entry},
+		Mode:               b.config.commitMode,
+		PullRequestOptions: b.config.pullRequest,
+	})
+	return err
+}
@@ -1,70 +1,423 @@
 package codeowners
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type File struct {
 	RepositoryName  string
 	RepositoryOwner string
 	Branch          string
+	Path            string
+	ManagedSection  string
+	Dialect         string
 	Ruleset         Ruleset
+	// Sections follow the rules of the Ruleset, and are only supported by the GitLab dialect.
+	Sections []Section
+	Format   Format
 }
 
+const (
+	dialectGitHub = "github"
+	dialectGitLab = "gitlab"
+)
+
+var dialects = []string{dialectGitHub, dialectGitLab}
+
+// Section is a GitLab CODEOWNERS section, introduced by a "[Name]" line. Optional sections are prefixed with "^",
+// the number of approvals required follows the name as "[N]" and the default owners of the rules in the section
+// follow on the same line.
+type Section struct {
+	Name          string
+	Optional      bool
+	Approvals     int
+	DefaultOwners []string
+	Rules         Ruleset
+}
+
+// Format controls the layout of a compiled CODEOWNERS file. It never changes the rules the file is read back as.
+type Format struct {
+	// AlignOwners pads the patterns so that the owners of the rules of a ruleset start in the same column.
+	AlignOwners bool
+	// TeamsFirst sorts the owners of each rule, teams before users and email addresses.
+	TeamsFirst bool
+	// Header is rendered as comment lines at the top of the file, unless empty. Other than the generated header, it is
+	// separated from the rules by an empty line, so that it isn't read back as the comment of the first rule.
+	Header string
+	// Footer is rendered as comment lines at the end of the file, unless empty.
+	Footer string
+	// Variables are made available to the header and footer templates.
+	Variables map[string]string
+}
+
+// defaultFormat renders the generated header, and the rules as they are.
+var defaultFormat = Format{Header: defaultHeader}
+
 type Ruleset []Rule
 
 type Rule struct {
 	Pattern   string
 	Usernames []string
+	// Comment is rendered as comment lines directly above the rule.
+	Comment string
+	// Heading groups consecutive rules under a "## Heading" line.
+	Heading string
 }
 
+const defaultHeader = "automatically generated by terraform - please do not edit here"
+
+const generatedHeader = "# " + defaultHeader
+
+const headingPrefix = "## "
+
 func (ruleset Ruleset) Compile() []byte {
 	if ruleset == nil {
 		return []byte{}
 	}
-	output := "# automatically generated by terraform - please do not edit here\n"
+	return []byte(defaultFormat.compileHeader() + ruleset.compileRules(defaultFormat))
+}
+
+// compileHeader returns the comment lines at the top of the file.
+func (format Format) compileHeader() string {
+	switch format.Header {
+	case "":
+		return ""
+	case defaultHeader:
+		// the generated header is skipped when parsing, so it needn't be separated from the rules
+		return generatedHeader + "\n"
+	}
+	return compileComment(format.Header) + "\n"
+}
+
+// compileFooter returns the comment lines at the end of the file, separated from the rules so that they aren't read
+// back as the comment of a rule.
+func (format Format) compileFooter() string {
+	if format.Footer == "" {
+		return ""
+	}
+	return "\n" + compileComment(format.Footer)
+}
+
+// compileComment renders the text as comment lines.
+func compileComment(text string) string {
+	output := ""
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		output = fmt.Sprintf("%s%s\n", output, strings.TrimRight("# "+line, " "))
+	}
+	return output
+}
+
+// sortOwners returns the owners in the order they are compiled in: as given, or teams first when requested.
+func (format Format) sortOwners(owners []string) []string {
+	if !format.TeamsFirst {
+		return owners
+	}
+	rank := map[ownerKind]int{ownerKindTeam: 0, ownerKindUser: 1, ownerKindEmail: 2}
+	sorted := append([]string{}, owners...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ki, _ := classifyOwner(sorted[i])
+		kj, _ := classifyOwner(sorted[j])
+		if ki != kj {
+			return rank[ki] < rank[kj]
+		}
+		return normaliseOwner(sorted[i]) < normaliseOwner(sorted[j])
+	})
+	return sorted
+}
+
+// compileRules renders the rules, along with their comments and headings.
+func (ruleset Ruleset) compileRules(format Format) string {
+	// width is the column the owners are aligned to, if requested.
+	width := 0
+	if format.AlignOwners {
+		for _, rule := range ruleset {
+			if n := utf8.RuneCountInString(escapePattern(rule.Pattern)); len(rule.Usernames) > 0 && n > width {
+				width = n
+			}
+		}
+	}
+
+	output := ""
+	heading := ""
 	for _, rule := range ruleset {
-		usernames := []string{}
-		for _, username := range rule.Usernames {
-			if !strings.HasPrefix(username, "@") {
-				username = "@" + username
+		if rule.Heading != heading {
+			heading = rule.Heading
+			if heading != "" {
+				output = fmt.Sprintf("%s\n%s%s\n", output, headingPrefix, heading)
 			}
+		}
+		if rule.Comment != "" {
+			output += compileComment(rule.Comment)
+		}
+		output = fmt.Sprintf("%s%s\n", output, rule.compile(format, width))
+	}
+	return output
+}
+
+// compile renders the rules and sections of the file according to its dialect and format.
+func (file *File) compile() []byte {
+	if file.Ruleset == nil && len(file.Sections) == 0 {
+		return []byte{}
+	}
+	output := file.Format.compileHeader() + file.Ruleset.compileRules(file.Format)
+	if file.Dialect == dialectGitLab {
+		for _, section := range file.Sections {
+			output = fmt.Sprintf("%s\n%s\n%s", output, section.compileHeader(file.Format), section.Rules.compileRules(file.Format))
+		}
+	}
+	return []byte(output + file.Format.compileFooter())
+}
+
+// compileHeader returns the line introducing the section.
+func (section Section) compileHeader(format Format) string {
+	header := fmt.Sprintf("[%s]", section.Name)
+	if section.Optional {
+		header = "^" + header
+	}
+	if section.Approvals > 0 {
+		header = fmt.Sprintf("%s[%d]", header, section.Approvals)
+	}
+	if len(section.DefaultOwners) > 0 {
+		header = fmt.Sprintf("%s %s", header, compileOwners(format.sortOwners(section.DefaultOwners)))
+	}
+	return header
+}
+
+// Match returns the index of the rule which applies to the file at the given path, or -1 if no rule matches it. As
+// with GitHub, the last matching rule wins. To match many paths, compile the patterns once using matcher instead.
+func (ruleset Ruleset) Match(path string) int {
+	return ruleset.matcher().match(path)
+}
+
+// rulesetMatcher holds the compiled patterns of a ruleset, in the same order as its rules. Patterns which fail to
+// compile are nil, and never match.
+type rulesetMatcher []*patternMatcher
+
+// matcher compiles the patterns of the ruleset.
+func (ruleset Ruleset) matcher() rulesetMatcher {
+	matchers := make(rulesetMatcher, len(ruleset))
+	for i, rule := range ruleset {
+		matchers[i], _ = newPatternMatcher(rule.Pattern)
+	}
+	return matchers
+}
 
-			usernames = append(usernames, username)
+// match returns the index of the rule which applies to the file at the given path, or -1 if no rule matches it.
+func (matchers rulesetMatcher) match(path string) int {
+	for i := len(matchers) - 1; i >= 0; i-- {
+		if matchers[i] != nil && matchers[i].match(path) {
+			return i
 		}
-		output = fmt.Sprintf("%s%s %s\n", output, rule.Pattern, strings.Join(usernames, " "))
 	}
-	return []byte(output)
+	return -1
 }
 
-func parseRulesFile(data string) Ruleset {
+// Compile returns the line representing the rule in a CODEOWNERS file.
+func (rule Rule) Compile() string {
+	return rule.compile(Format{}, 0)
+}
+
+// compile returns the line representing the rule in the given format, padding the pattern to the given width.
+func (rule Rule) compile(format Format, width int) string {
+	pattern := escapePattern(rule.Pattern)
+	if len(rule.Usernames) == 0 {
+		// only valid within a GitLab section, where the rule falls back to the default owners of the section
+		return pattern
+	}
+	padding := " "
+	if n := width - utf8.RuneCountInString(pattern); n > 0 {
+		padding += strings.Repeat(" ", n)
+	}
+	return pattern + padding + compileOwners(format.sortOwners(rule.Usernames))
+}
+
+func compileOwners(owners []string) string {
+	usernames := []string{}
+	for _, username := range owners {
+		usernames = append(usernames, compileOwner(username))
+	}
+	return strings.Join(usernames, " ")
+}
+
+// parseSectionHeader parses a GitLab section header such as "^[Name][2] @owner", returning false if the line isn't
+// one. The default owners are tokenized like the owners of a rule, and the first invalid one is reported in the
+// returned error, along with the section and the owners preceding it.
+func parseSectionHeader(line string) (Section, bool, error) {
+	var section Section
+	// offset is the number of bytes of the line consumed so far, to report the columns of the owners.
+	offset := 0
+	if strings.HasPrefix(line, "^[") {
+		section.Optional = true
+		offset++
+	}
+	if !strings.HasPrefix(line[offset:], "[") {
+		return section, false, nil
+	}
+	end := strings.Index(line[offset:], "]")
+	if end <= 1 {
+		return section, false, nil
+	}
+	section.Name = line[offset+1 : offset+end]
+	offset += end + 1
+
+	if strings.HasPrefix(line[offset:], "[") {
+		end = strings.Index(line[offset:], "]")
+		if end == -1 {
+			return section, false, nil
+		}
+		approvals, err := strconv.Atoi(line[offset+1 : offset+end])
+		if err != nil {
+			return section, false, nil
+		}
+		section.Approvals = approvals
+		offset += end + 1
+	}
+	if offset < len(line) && line[offset] != ' ' && line[offset] != '\t' {
+		return section, false, nil
+	}
+
+	tokens, err := tokenizeLine(line[offset:])
+	for _, owner := range tokens {
+		if _, ownerErr := classifyOwner(owner.Text); ownerErr != nil {
+			return section, true, &tokenError{Column: offset + owner.Column, Err: ownerErr}
+		}
+		section.DefaultOwners = append(section.DefaultOwners, normaliseOwner(owner.Text))
+	}
+	var tokenErr *tokenError
+	if errors.As(err, &tokenErr) {
+		return section, true, &tokenError{Column: offset + tokenErr.Column, Err: tokenErr.Err}
+	}
+	return section, true, nil
+}
+
+// parseError describes a line of a CODEOWNERS file which could not be interpreted.
+type parseError struct {
+	Line int
+	// Column is the 1-based byte offset within the line at which the problem was found.
+	Column int
+	Text   string
+	Err    error
+}
+
+func (e parseError) Error() string {
+	return fmt.Sprintf("line %d, column %d %q: %v", e.Line, e.Column, e.Text, e.Err)
+}
+
+// parseErrors lists every line of a CODEOWNERS file which could not be interpreted.
+type parseErrors []parseError
+
+func (e parseErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// parseRulesFile parses the rules of a CODEOWNERS file. Lines which cannot be interpreted are skipped, and reported
+// in the returned error.
+func parseRulesFile(data string) (Ruleset, error) {
+	rules, _, err := parseCodeowners(data, dialectGitHub)
+	return rules, err
+}
+
+// parseCodeowners parses the rules of a CODEOWNERS file, along with its sections when using the GitLab dialect.
+// Lines which cannot be interpreted are skipped, and reported in the returned error.
+func parseCodeowners(data, dialect string) (Ruleset, []Section, error) {
 	var rules []Rule
+	var sections []Section
+	var errs parseErrors
+	// add appends a rule to the current section, or to the rules preceding any section.
+	add := func(rule Rule) {
+		if len(sections) > 0 {
+			sections[len(sections)-1].Rules = append(sections[len(sections)-1].Rules, rule)
+			return
+		}
+		rules = append(rules, rule)
+	}
+	// comments holds the comment lines directly above the current line, which are attached to the following rule.
+	var comments []string
+	heading := ""
 	lines := strings.Split(data, "\n")
-	for _, line := range lines {
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
 		trimmed := strings.TrimSpace(line)
-		if len(trimmed) == 0 {
+		if len(trimmed) == 0 || trimmed == generatedHeader {
+			comments = nil
 			continue
 		}
-		if trimmed[0] == '#' { // ignore comments
+		if strings.HasPrefix(trimmed, headingPrefix) {
+			heading = strings.TrimSpace(strings.TrimPrefix(trimmed, headingPrefix))
+			comments = nil
 			continue
 		}
-		words := strings.Split(trimmed, " ")
-		if len(words) < 2 {
+		if trimmed[0] == '#' {
+			comments = append(comments, strings.TrimPrefix(strings.TrimPrefix(trimmed, "#"), " "))
 			continue
 		}
-		rule := Rule{
-			Pattern: words[0],
-		}
-		for _, username := range words[1:] {
-			if len(username) == 0 { // may be split by multiple spaces
+		if dialect == dialectGitLab {
+			if section, ok, err := parseSectionHeader(trimmed); ok {
+				// The section is kept even if some of its default owners are invalid, so that its rules stay within it.
+				var tokenErr *tokenError
+				if errors.As(err, &tokenErr) {
+					indent := len(line) - len(strings.TrimLeft(line, " \t"))
+					errs = append(errs, parseError{Line: i + 1, Column: indent + tokenErr.Column, Text: trimmed, Err: err})
+				}
+				sections = append(sections, section)
+				heading = ""
+				comments = nil
 				continue
 			}
+		}
 
-			rule.Usernames = append(rule.Usernames, strings.TrimPrefix(username, "@"))
+		tokens, err := tokenizeLine(line)
+		if err == nil && len(tokens) == 0 {
+			comments = nil
+			continue
 		}
-		rules = append(rules, rule)
+		var rule Rule
+		if err == nil {
+			rule, err = parseRule(tokens)
+		}
+		if err != nil {
+			column := 1
+			var tokenErr *tokenError
+			if errors.As(err, &tokenErr) {
+				column = tokenErr.Column
+			}
+			errs = append(errs, parseError{Line: i + 1, Column: column, Text: trimmed, Err: err})
+			comments = nil
+			continue
+		}
+		rule.Comment = strings.Join(comments, "\n")
+		rule.Heading = heading
+		comments = nil
+		add(rule)
 	}
 
-	return rules
+	if len(errs) > 0 {
+		return rules, sections, errs
+	}
+	return rules, sections, nil
+}
+
+// parseRule parses the tokens of a rule line: a pattern followed by its owners. A rule may have no owners, in which
+// case nobody owns the matching files, or within a GitLab section, the section's default owners do.
+func parseRule(tokens []token) (Rule, error) {
+	rule := Rule{Pattern: unescapePattern(tokens[0].Text)}
+	if err := checkPattern(rule.Pattern); err != nil {
+		return rule, &tokenError{Column: tokens[0].Column, Err: err}
+	}
+	for _, owner := range tokens[1:] {
+		if _, err := classifyOwner(owner.Text); err != nil {
+			return rule, &tokenError{Column: owner.Column, Err: err}
+		}
+		rule.Usernames = append(rule.Usernames, normaliseOwner(owner.Text))
+	}
+	return rule, nil
 }
@@ -1,9 +1,11 @@
 package codeowners
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -54,8 +56,20 @@ func TestRulesetCompilation(t *testing.T) {
 	}
 }
 
+func TestRulesetCompilationEscapesPatterns(t *testing.T) {
+	ruleset := Ruleset{
+		{Pattern: "docs/My Folder/", Usernames: []string{"designer"}},
+		{Pattern: "notes/a\tb.txt", Usernames: []string{"writer"}},
+	}
+	assert.Equal(t, generatedHeader+"\ndocs/My\\ Folder/ @designer\nnotes/a\\\tb.txt @writer\n", string(ruleset.Compile()))
+
+	parsed, err := parseRulesFile(string(ruleset.Compile()))
+	require.NoError(t, err)
+	assert.Equal(t, ruleset, parsed)
+}
+
 func TestRulesetParsing(t *testing.T) {
-	ruleset := parseRulesFile(`
+	ruleset, err := parseRulesFile(`
 # this is an example file
 
 # with blank lines
@@ -65,6 +79,7 @@ func TestRulesetParsing(t *testing.T) {
 * @user1
 *.go @user123 @user456
 `)
+	require.NoError(t, err)
 
 	require.Len(t, ruleset, 2)
 	assert.Equal(t, "*", ruleset[0].Pattern)
@@ -73,3 +88,341 @@ func TestRulesetParsing(t *testing.T) {
 	assert.Equal(t, []string{"user123", "user456"}, ruleset[1].Usernames)
 
 }
+
+func TestRulesetCommentsAndHeadingsRoundTrip(t *testing.T) {
+	ruleset := Ruleset{
+		{Pattern: "*", Usernames: []string{"expert"}},
+		{Pattern: "*.tf", Usernames: []string{"my-org/platform"}, Heading: "Infrastructure", Comment: "modules\nand providers"},
+		{Pattern: "*.tfvars", Usernames: []string{"ops"}, Heading: "Infrastructure"},
+		{Pattern: "*.go", Usernames: []string{"gopher"}, Heading: "Services", Comment: "backend"},
+	}
+
+	compiled := string(ruleset.Compile())
+	assert.Equal(t, `# automatically generated by terraform - please do not edit here
+* @expert
+
+## Infrastructure
+# modules
+# and providers
+*.tf @my-org/platform
+*.tfvars @ops
+
+## Services
+# backend
+*.go @gopher
+`, compiled)
+
+	parsed, err := parseRulesFile(compiled)
+	require.NoError(t, err)
+	assert.Equal(t, ruleset, parsed)
+}
+
+func TestRulesetParsingDetachedComments(t *testing.T) {
+	ruleset, err := parseRulesFile(`# a comment separated from the rule by a blank line
+
+# attached
+* @user1
+`)
+	require.NoError(t, err)
+
+	require.Len(t, ruleset, 1)
+	assert.Equal(t, "attached", ruleset[0].Comment)
+	assert.Equal(t, "", ruleset[0].Heading)
+}
+
+func TestGitLabSectionsRoundTrip(t *testing.T) {
+	file := &File{
+		Dialect: dialectGitLab,
+		Format:  defaultFormat,
+		Ruleset: Ruleset{{Pattern: "*", Usernames: []string{"expert"}}},
+		Sections: []Section{
+			{
+				Name:          "Documentation",
+				Optional:      true,
+				DefaultOwners: []string{"writers"},
+				Rules:         Ruleset{{Pattern: "docs/"}, {Pattern: "*.md", Usernames: []string{"editor"}}},
+			},
+			{
+				Name:      "Backend Services",
+				Approvals: 2,
+				Rules:     Ruleset{{Pattern: "*.go", Usernames: []string{"my-org/gophers"}, Comment: "services"}},
+			},
+		},
+	}
+
+	compiled := string(file.compile())
+	assert.Equal(t, `# automatically generated by terraform - please do not edit here
+* @expert
+
+^[Documentation] @writers
+docs/
+*.md @editor
+
+[Backend Services][2]
+# services
+*.go @my-org/gophers
+`, compiled)
+
+	rules, sections, err := parseCodeowners(compiled, dialectGitLab)
+	require.NoError(t, err)
+	assert.Equal(t, file.Ruleset, rules)
+	assert.Equal(t, file.Sections, sections)
+}
+
+func TestFileFormat(t *testing.T) {
+	file := &File{
+		Ruleset: Ruleset{
+			{Pattern: "*", Usernames: []string{"expert"}},
+			{Pattern: "docs/My Folder/", Usernames: []string{"writer@example.com", "designer", "my-org/design"}},
+			{Pattern: "*.go", Usernames: []string{"gopher", "my-org/gophers", "my-org/backend"}, Heading: "Backend"},
+		},
+		Format: Format{AlignOwners: true, TeamsFirst: true, Header: "owned by the platform team\nsee https://example.com/codeowners"},
+	}
+
+	compiled := string(file.compile())
+	assert.Equal(t, `# owned by the platform team
+# see https://example.com/codeowners
+
+*                @expert
+docs/My\ Folder/ @my-org/design @designer writer@example.com
+
+## Backend
+*.go             @my-org/backend @my-org/gophers @gopher
+`, compiled)
+
+	// The format never changes the rules the file is read back as.
+	rules, err := parseRulesFile(compiled)
+	require.NoError(t, err)
+	unformatted, err := parseRulesFile(string(file.Ruleset.Compile()))
+	require.NoError(t, err)
+	assert.Equal(t, len(file.Ruleset), len(rules))
+	for i := range rules {
+		assert.ElementsMatch(t, unformatted[i].Usernames, rules[i].Usernames)
+		unformatted[i].Usernames, rules[i].Usernames = nil, nil
+	}
+	assert.Equal(t, unformatted, rules)
+}
+
+func TestParseSectionHeader(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected Section
+		ok       bool
+		err      string
+		column   int
+	}{
+		{line: "[Section]", expected: Section{Name: "Section"}, ok: true},
+		{line: "^[Optional Section]", expected: Section{Name: "Optional Section", Optional: true}, ok: true},
+		{line: "[Section][3] @a @my-org/b", expected: Section{Name: "Section", Approvals: 3, DefaultOwners: []string{"a", "my-org/b"}}, ok: true},
+		{line: "[Docs]\t@writers # the docs team", expected: Section{Name: "Docs", DefaultOwners: []string{"writers"}}, ok: true},
+		{
+			line:     "^[Docs][2] @writers @bad@owner",
+			expected: Section{Name: "Docs", Optional: true, Approvals: 2, DefaultOwners: []string{"writers"}},
+			ok:       true,
+			err:      `"@bad@owner" is not a valid owner - expected @username, @org/team-name or an email address`,
+			column:   21,
+		},
+		{line: "[Docs] @writers\\", expected: Section{Name: "Docs"}, ok: true, err: "a backslash must be followed by the character it escapes", column: 16},
+		{line: "[Section][x]", ok: false},
+		{line: "[]", ok: false},
+		{line: "[abc]def @owner", ok: false},
+		{line: "*.go @owner", ok: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			actual, ok, err := parseSectionHeader(test.line)
+			assert.Equal(t, test.ok, ok)
+			if test.ok {
+				assert.Equal(t, test.expected, actual)
+			}
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var tokenErr *tokenError
+			require.True(t, errors.As(err, &tokenErr))
+			assert.EqualError(t, tokenErr, test.err)
+			assert.Equal(t, test.column, tokenErr.Column)
+		})
+	}
+}
+
+func TestGitLabSectionHeaderErrors(t *testing.T) {
+	_, sections, err := parseCodeowners("[Docs] @writers # the docs team\n  [Build] @bad@owner\n*.sh @builder\n", dialectGitLab)
+	assert.Equal(t, []Section{
+		{Name: "Docs", DefaultOwners: []string{"writers"}},
+		{Name: "Build", Rules: Ruleset{{Pattern: "*.sh", Usernames: []string{"builder"}}}},
+	}, sections)
+	assert.EqualError(t, err, `line 2, column 11 "[Build] @bad@owner": "@bad@owner" is not a valid owner - expected @username, @org/team-name or an email address`)
+}
+
+func TestGitHubDialectIgnoresSections(t *testing.T) {
+	rules, sections, err := parseCodeowners("[Section] @owner\n*.go @gopher\n", dialectGitHub)
+	assert.Nil(t, sections)
+	assert.Equal(t, Ruleset{{Pattern: "*.go", Usernames: []string{"gopher"}}}, rules)
+	assert.EqualError(t, err, `line 1, column 1 "[Section] @owner": character ranges using [ ] are not supported`)
+}
+
+func TestRulesetParsingReportsUninterpretableLines(t *testing.T) {
+	ruleset, err := parseRulesFile("*.go\t@gopher  @my-org/gophers\n!*.md @writer\n*.js @@frontend\n/build/\n")
+
+	assert.Equal(t, Ruleset{
+		{Pattern: "*.go", Usernames: []string{"gopher", "my-org/gophers"}},
+		{Pattern: "/build/"},
+	}, ruleset)
+
+	var errs parseErrors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 2)
+	assert.Equal(t, 2, errs[0].Line)
+	assert.Equal(t, 3, errs[1].Line)
+}
+
+func TestRulesetMatch(t *testing.T) {
+	ruleset := Ruleset{
+		{Pattern: "*", Usernames: []string{"expert"}},
+		{Pattern: "*.go", Usernames: []string{"gopher"}},
+		{Pattern: "/docs/", Usernames: []string{"writer"}},
+		{Pattern: "/docs/*.go", Usernames: []string{"gopher", "writer"}},
+	}
+
+	assert.Equal(t, 0, ruleset.Match("README.md"))
+	assert.Equal(t, 1, ruleset.Match("cmd/main.go"))
+	assert.Equal(t, 2, ruleset.Match("docs/nested/index.go"))
+	assert.Equal(t, 3, ruleset.Match("docs/example.go"))
+	assert.Equal(t, -1, Ruleset{{Pattern: "*.go", Usernames: []string{"gopher"}}}.Match("README.md"))
+}
+
+func TestRulesetMatcher(t *testing.T) {
+	ruleset := Ruleset{
+		{Pattern: "*.go", Usernames: []string{"gopher"}},
+		{Pattern: "/cmd/", Usernames: []string{"platform"}},
+	}
+
+	// The compiled patterns are reused for every path.
+	matcher := ruleset.matcher()
+	require.Len(t, matcher, 2)
+	assert.Equal(t, 0, matcher.match("main.go"))
+	assert.Equal(t, 1, matcher.match("cmd/app/main.go"))
+	assert.Equal(t, -1, matcher.match("README.md"))
+}
+
+func TestRulesetParsingGrammar(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected Ruleset
+		errors   []string
+	}{
+		{
+			name:     "crlf line endings",
+			data:     "* @expert\r\n*.go @my-org/gophers\r\n",
+			expected: Ruleset{{Pattern: "*", Usernames: []string{"expert"}}, {Pattern: "*.go", Usernames: []string{"my-org/gophers"}}},
+		},
+		{
+			name:     "tabs",
+			data:     "*.go\t\t@gopher\t@my-org/gophers\n",
+			expected: Ruleset{{Pattern: "*.go", Usernames: []string{"gopher", "my-org/gophers"}}},
+		},
+		{
+			name:     "inline comments",
+			data:     "*.go @gopher # the backend team\n",
+			expected: Ruleset{{Pattern: "*.go", Usernames: []string{"gopher"}}},
+		},
+		{
+			name:     "escaped spaces",
+			data:     "docs/My\\ Folder/ @designer\n",
+			expected: Ruleset{{Pattern: "docs/My Folder/", Usernames: []string{"designer"}}},
+		},
+		{
+			name:     "errors",
+			data:     "*.go @gopher\n*.md @writer @bad@owner\n*.js\\\n",
+			expected: Ruleset{{Pattern: "*.go", Usernames: []string{"gopher"}}},
+			errors: []string{
+				`line 2, column 14 "*.md @writer @bad@owner": "@bad@owner" is not a valid owner - expected @username, @org/team-name or an email address`,
+				`line 3, column 5 "*.js\\": a backslash must be followed by the character it escapes`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ruleset, err := parseRulesFile(test.data)
+			assert.Equal(t, test.expected, ruleset)
+			if len(test.errors) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var errs parseErrors
+			require.True(t, errors.As(err, &errs))
+			var messages []string
+			for _, e := range errs {
+				messages = append(messages, e.Error())
+			}
+			assert.Equal(t, test.errors, messages)
+		})
+	}
+}
+
+// FuzzRulesetRoundTrip checks that parsing a compiled ruleset gives back the same ruleset.
+func FuzzRulesetRoundTrip(f *testing.F) {
+	f.Add("*.go", "gopher my-org/gophers gopher@example.com", "", "", "/docs/", "writer")
+	f.Add("docs/My Folder/", "designer", "owned by design\nask in #design", "Design", "*", "expert")
+	f.Add("**/logs", "", "", "Infrastructure", "apps/*.tf", "my-org/platform")
+
+	f.Fuzz(func(t *testing.T, pattern1, owners1, comment, heading, pattern2, owners2 string) {
+		ruleset := Ruleset{
+			{Pattern: pattern1, Usernames: strings.Fields(owners1), Comment: comment, Heading: heading},
+			{Pattern: pattern2, Usernames: strings.Fields(owners2), Heading: heading},
+		}
+		for _, rule := range ruleset {
+			if !roundTrippable(rule) {
+				t.Skip()
+			}
+		}
+
+		parsed, err := parseRulesFile(string(ruleset.Compile()))
+		require.NoError(t, err)
+		assert.Equal(t, normaliseRuleset(ruleset), parsed)
+	})
+}
+
+// roundTrippable returns whether the rule can be represented in a CODEOWNERS file at all.
+func roundTrippable(rule Rule) bool {
+	if checkPattern(rule.Pattern) != nil {
+		return false
+	}
+	for _, owner := range rule.Usernames {
+		if _, err := classifyOwner(owner); err != nil {
+			return false
+		}
+	}
+	if !utf8.ValidString(rule.Comment) || !utf8.ValidString(rule.Heading) || !utf8.ValidString(rule.Pattern) {
+		return false
+	}
+	// Headings and comment lines are single lines without surrounding whitespace.
+	if strings.ContainsAny(rule.Heading, "\r\n") || strings.TrimSpace(rule.Heading) != rule.Heading {
+		return false
+	}
+	for _, line := range strings.Split(rule.Comment, "\n") {
+		if strings.TrimSpace(line) != line || strings.ContainsRune(line, '\r') || "# "+line == generatedHeader {
+			return false
+		}
+	}
+	return rule.Comment == "" || !strings.HasSuffix(rule.Comment, "\n")
+}
+
+// normaliseRuleset returns the ruleset in the form it takes once parsed.
+func normaliseRuleset(ruleset Ruleset) Ruleset {
+	out := Ruleset{}
+	for _, rule := range ruleset {
+		var owners []string
+		for _, owner := range rule.Usernames {
+			owners = append(owners, normaliseOwner(owner))
+		}
+		rule.Usernames = owners
+		out = append(out, rule)
+	}
+	return out
+}
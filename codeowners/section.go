@@ -0,0 +1,112 @@
+package codeowners
+
+import (
+	"log"
+	"strings"
+)
+
+// managedSectionBegin returns the line marking the start of a managed section.
+func managedSectionBegin(name string) string {
+	return "# BEGIN " + name
+}
+
+// managedSectionEnd returns the line marking the end of a managed section.
+func managedSectionEnd(name string) string {
+	return "# END " + name
+}
+
+// findManagedSection returns the indices of the lines marking the start and end of the named section, or -1 for
+// both if the section does not exist.
+func findManagedSection(lines []string, name string) (int, int) {
+	begin, end := managedSectionBegin(name), managedSectionEnd(name)
+	start := -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case start == -1 && trimmed == begin:
+			start = i
+		case start != -1 && trimmed == end:
+			return start, i
+		}
+	}
+	return -1, -1
+}
+
+// extractManagedSection returns the content between the markers of the named section, and whether the section
+// exists.
+func extractManagedSection(content, name string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	start, end := findManagedSection(lines, name)
+	if start == -1 {
+		return "", false
+	}
+	return strings.Join(lines[start+1:end], "\n"), true
+}
+
+// replaceManagedSection returns the content with the named section replaced by the given one, preserving everything
+// outside the section verbatim. The section is appended if it doesn't exist yet.
+func replaceManagedSection(content, name string, section []byte) string {
+	managed := managedSectionBegin(name) + "\n" + string(section) + managedSectionEnd(name) + "\n"
+
+	lines := strings.Split(content, "\n")
+	start, end := findManagedSection(lines, name)
+	if start == -1 {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return content + managed
+	}
+
+	before := strings.Join(lines[:start], "\n")
+	if start > 0 {
+		before += "\n"
+	}
+	after := strings.Join(lines[end+1:], "\n")
+	return before + managed + after
+}
+
+// removeManagedSection returns the content with the named section, including its markers, removed.
+func removeManagedSection(content, name string) string {
+	return unwrapManagedSection(content, name, nil)
+}
+
+// unwrapManagedSection returns the content with the named section, including its markers, replaced by the given
+// lines.
+func unwrapManagedSection(content, name string, section []byte) string {
+	lines := strings.Split(content, "\n")
+	start, end := findManagedSection(lines, name)
+	if start == -1 {
+		return content
+	}
+	unwrapped := lines[:start:start]
+	if len(section) > 0 {
+		unwrapped = append(unwrapped, strings.Split(strings.TrimSuffix(string(section), "\n"), "\n")...)
+	}
+	return strings.Join(append(unwrapped, lines[end+1:]...), "\n")
+}
+
+// render returns the content of the CODEOWNERS file given its existing content.
+func (file *File) render(existing string) string {
+	if file.ManagedSection == "" {
+		return string(file.compile())
+	}
+	return replaceManagedSection(existing, file.ManagedSection, file.compile())
+}
+
+// managedRules returns the rules and sections managed by the resource within the content of the CODEOWNERS file,
+// and whether they are present at all.
+func (file *File) managedRules(content string) (Ruleset, []Section, bool) {
+	if file.ManagedSection != "" {
+		section, ok := extractManagedSection(content, file.ManagedSection)
+		if !ok {
+			return nil, nil, false
+		}
+		content = section
+	}
+	rules, sections, err := parseCodeowners(content, file.Dialect)
+	if err != nil {
+		// The rules which could be interpreted are still reported, so that applying replaces the broken lines.
+		log.Printf("[WARN] skipped lines of %s which could not be interpreted: %v", file.Path, err)
+	}
+	return rules, sections, true
+}
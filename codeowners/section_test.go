@@ -0,0 +1,99 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sectionTestFile = `# maintained by the product team
+*.js @frontend
+
+# BEGIN terraform-managed
+* @platform
+# END terraform-managed
+
+docs/ @writers
+`
+
+func TestExtractManagedSection(t *testing.T) {
+	content, ok := extractManagedSection(sectionTestFile, "terraform-managed")
+	assert.True(t, ok)
+	assert.Equal(t, "* @platform", content)
+
+	_, ok = extractManagedSection(sectionTestFile, "other")
+	assert.False(t, ok)
+
+	_, ok = extractManagedSection("# BEGIN terraform-managed\n* @platform\n", "terraform-managed")
+	assert.False(t, ok, "a section without an end marker should not be found")
+}
+
+func TestReplaceManagedSection(t *testing.T) {
+	expected := `# maintained by the product team
+*.js @frontend
+
+# BEGIN terraform-managed
+* @platform @security
+*.go @gophers
+# END terraform-managed
+
+docs/ @writers
+`
+	actual := replaceManagedSection(sectionTestFile, "terraform-managed", []byte("* @platform @security\n*.go @gophers\n"))
+	assert.Equal(t, expected, actual)
+
+	// Replacing with the same rules leaves the file untouched.
+	assert.Equal(t, sectionTestFile, replaceManagedSection(sectionTestFile, "terraform-managed", []byte("* @platform\n")))
+}
+
+func TestReplaceManagedSectionAppendsMissingSection(t *testing.T) {
+	assert.Equal(t,
+		"*.js @frontend\n# BEGIN terraform-managed\n* @platform\n# END terraform-managed\n",
+		replaceManagedSection("*.js @frontend", "terraform-managed", []byte("* @platform\n")))
+
+	assert.Equal(t,
+		"# BEGIN terraform-managed\n* @platform\n# END terraform-managed\n",
+		replaceManagedSection("", "terraform-managed", []byte("* @platform\n")))
+}
+
+func TestRemoveManagedSection(t *testing.T) {
+	// Everything outside the section is preserved verbatim, including the blank lines around it.
+	expected := `# maintained by the product team
+*.js @frontend
+
+
+docs/ @writers
+`
+	assert.Equal(t, expected, removeManagedSection(sectionTestFile, "terraform-managed"))
+	assert.Equal(t, sectionTestFile, removeManagedSection(sectionTestFile, "other"))
+}
+
+func TestFileManagedRules(t *testing.T) {
+	file := &File{ManagedSection: "terraform-managed"}
+
+	rules, _, ok := file.managedRules(sectionTestFile)
+	assert.True(t, ok)
+	assert.Equal(t, Ruleset{{Pattern: "*", Usernames: []string{"platform"}}}, rules)
+
+	_, _, ok = file.managedRules("*.js @frontend\n")
+	assert.False(t, ok)
+
+	file.ManagedSection = ""
+	rules, _, ok = file.managedRules(sectionTestFile)
+	assert.True(t, ok)
+	assert.Len(t, rules, 3)
+}
+
+func TestFileRender(t *testing.T) {
+	file := &File{
+		ManagedSection: "terraform-managed",
+		Ruleset:        Ruleset{{Pattern: "*", Usernames: []string{"platform"}}},
+		Format:         defaultFormat,
+	}
+	rendered := file.render("*.js @frontend\n")
+	assert.Equal(t, "*.js @frontend\n# BEGIN terraform-managed\n"+string(file.Ruleset.Compile())+"# END terraform-managed\n", rendered)
+
+	rules, _, ok := file.managedRules(rendered)
+	assert.True(t, ok)
+	assert.Equal(t, file.Ruleset, rules)
+}
@@ -0,0 +1,62 @@
+package codeowners
+
+import (
+	"errors"
+)
+
+// token is a whitespace separated word of a CODEOWNERS line.
+type token struct {
+	Text string
+	// Column is the 1-based byte offset of the token within the line.
+	Column int
+}
+
+// tokenError is an error found at a given column of a line.
+type tokenError struct {
+	Column int
+	Err    error
+}
+
+func (e *tokenError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *tokenError) Unwrap() error {
+	return e.Err
+}
+
+// tokenizeLine splits a CODEOWNERS line into tokens, following GitHub's grammar: tokens are separated by spaces and
+// tabs, a backslash escapes the following character, which may be whitespace, and an unescaped "#" at the start of
+// a token starts a comment running to the end of the line. Escapes are kept in the tokens as they are.
+func tokenizeLine(line string) ([]token, error) {
+	var tokens []token
+	start := -1
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			if start != -1 {
+				tokens = append(tokens, token{Text: line[start:i], Column: start + 1})
+				start = -1
+			}
+		case c == '#' && start == -1:
+			return tokens, nil
+		case c == '\\':
+			if i+1 == len(line) {
+				return tokens, &tokenError{Column: i + 1, Err: errors.New("a backslash must be followed by the character it escapes")}
+			}
+			if start == -1 {
+				start = i
+			}
+			i++
+		default:
+			if start == -1 {
+				start = i
+			}
+		}
+	}
+	if start != -1 {
+		tokens = append(tokens, token{Text: line[start:], Column: start + 1})
+	}
+	return tokens, nil
+}
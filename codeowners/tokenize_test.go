@@ -0,0 +1,41 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenizeLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []token
+		column   int
+	}{
+		{line: "*.go @gopher", expected: []token{{"*.go", 1}, {"@gopher", 6}}},
+		{line: "*.go\t@gopher  \t@my-org/gophers", expected: []token{{"*.go", 1}, {"@gopher", 6}, {"@my-org/gophers", 16}}},
+		{line: "  *.go @gopher\r", expected: []token{{"*.go", 3}, {"@gopher", 8}}},
+		{line: `docs/My\ Folder/ @designer`, expected: []token{{`docs/My\ Folder/`, 1}, {"@designer", 18}}},
+		{line: "*.go @gopher # the backend team", expected: []token{{"*.go", 1}, {"@gopher", 6}}},
+		{line: "*.go @gopher#not-a-comment", expected: []token{{"*.go", 1}, {"@gopher#not-a-comment", 6}}},
+		{line: `\#hash @owner`, expected: []token{{`\#hash`, 1}, {"@owner", 8}}},
+		{line: "# a comment", expected: nil},
+		{line: "", expected: nil},
+		{line: `*.go\`, expected: nil, column: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			tokens, err := tokenizeLine(test.line)
+			if test.column != 0 {
+				var tokenErr *tokenError
+				if assert.ErrorAs(t, err, &tokenErr) {
+					assert.Equal(t, test.column, tokenErr.Column)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, tokens)
+		})
+	}
+}